@@ -0,0 +1,103 @@
+package colorquant
+
+import "math"
+
+// axisOffset shifts the projections to the principal axis to non-negative values.
+// A unit vector projects the 16 bit colors to at most sqrt(3) * 0xffff in absolute value.
+const axisOffset = 2 * 0xffff
+
+// project returns the projection of the color to the axis, shifted by axisOffset.
+func project(axis [3]float64, r, g, b uint32) uint32 {
+	return uint32(axis[0]*float64(r) + axis[1]*float64(g) + axis[2]*float64(b) + axisOffset + 0.5)
+}
+
+// setAxis computes the principal axis of the cluster colors, the eigenvector of their weighted
+// covariance matrix with the largest eigenvalue, and the range of the projections to the axis.
+// The cluster keeps splitting along the widest channel if its colors have no weight.
+func (qz *Quant) setAxis(c *cluster) {
+	var sw float64
+	var s [3]float64
+	var ss [3][3]float64
+	for _, p := range c.px {
+		w := qz.weight(p)
+		r, g, b, _ := qz.img.At(p.x, p.y).RGBA()
+		v := [3]float64{float64(r) / 0x101, float64(g) / 0x101, float64(b) / 0x101}
+		for i := range v {
+			s[i] += w * v[i]
+			for j := range v {
+				ss[i][j] += w * v[i] * v[j]
+			}
+		}
+		sw += w
+	}
+	if sw == 0 {
+		return
+	}
+	// Scatter matrix: the covariance multiplied by the total weight.
+	var cov [3][3]float64
+	for i := range cov {
+		for j := range cov[i] {
+			cov[i][j] = ss[i][j] - s[i]*s[j]/sw
+		}
+	}
+	axis, variance := principal(cov, c.widestCh)
+	if variance <= 0 {
+		return
+	}
+	c.axis = axis
+	c.axisVar = variance
+
+	min, max := uint32(math.MaxUint32), uint32(0)
+	for _, p := range c.px {
+		r, g, b, _ := qz.img.At(p.x, p.y).RGBA()
+		v := project(axis, r, g, b)
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	c.chMin = min
+	c.chRange = max - min
+}
+
+// principal returns the eigenvector with the largest eigenvalue of the symmetric positive
+// semi-definite matrix, together with the eigenvalue. It uses power iteration, starting from
+// the given channel's unit vector. The sign of the vector is chosen to make its largest
+// component positive, so that the result doesn't depend on the iteration.
+func principal(m [3][3]float64, ch int) ([3]float64, float64) {
+	var v [3]float64
+	v[ch] = 1
+	var lambda float64
+	for iter := 0; iter < 64; iter++ {
+		var n [3]float64
+		for i := range n {
+			n[i] = m[i][0]*v[0] + m[i][1]*v[1] + m[i][2]*v[2]
+		}
+		norm := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+		if norm == 0 {
+			return v, 0
+		}
+		for i := range n {
+			n[i] /= norm
+		}
+		d := math.Abs(n[0]-v[0]) + math.Abs(n[1]-v[1]) + math.Abs(n[2]-v[2])
+		v, lambda = n, norm
+		if d < 1e-9 {
+			break
+		}
+	}
+	big := 0
+	for i := range v {
+		if math.Abs(v[i]) > math.Abs(v[big]) {
+			big = i
+		}
+	}
+	if v[big] < 0 {
+		for i := range v {
+			v[i] = -v[i]
+		}
+	}
+	return v, lambda
+}
@@ -0,0 +1,54 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestPrincipal(t *testing.T) {
+	// The covariance of colors spread along the R=-B diagonal.
+	m := [3][3]float64{
+		{2, 0, -2},
+		{0, 0.5, 0},
+		{-2, 0, 2},
+	}
+	v, lambda := principal(m, rx)
+	want := [3]float64{1 / math.Sqrt2, 0, -1 / math.Sqrt2}
+	for i := range v {
+		if math.Abs(v[i]-want[i]) > 1e-6 {
+			t.Fatalf("Expected the principal axis %v, got %v", want, v)
+		}
+	}
+	if math.Abs(lambda-4) > 1e-6 {
+		t.Errorf("Expected the eigenvalue 4, got %f", lambda)
+	}
+}
+
+func TestQuant_PrincipalAxis(t *testing.T) {
+	// A cloud of colors elongated diagonally in the color space.
+	rnd := rand.New(rand.NewSource(3))
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v, n := rnd.Float64()*200, rnd.Float64()*60
+			img.Set(x, y, color.RGBA{uint8(v + n), uint8(v - n + 60), uint8(30 + n), 0xff})
+		}
+	}
+	for _, n := range []int{4, 16} {
+		for _, cut := range []CutMethod{CutMedian, CutMean, CutVariance} {
+			res := Quant{Cut: cut}.Quantize(img, n)
+			pres := Quant{Cut: cut, PrincipalAxis: true}.Quantize(img, n)
+			if p := pres.(*image.Paletted); len(p.Palette) != n {
+				t.Errorf("Expected %d colors, got %d", n, len(p.Palette))
+			}
+			psnr, _ := PSNR(img, res)
+			ppsnr, _ := PSNR(img, pres)
+			if ppsnr <= psnr {
+				t.Errorf("Expected the principal axis split to improve the PSNR with %d colors and cut %d: %.2f <= %.2f", n, cut, ppsnr, psnr)
+			}
+		}
+	}
+}
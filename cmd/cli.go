@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"image"
+	"image/color"
 	"image/color/palette"
 	"image/jpeg"
 	"image/png"
@@ -12,6 +13,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/esimov/colorquant"
@@ -26,7 +28,9 @@ var (
 	output      string
 	ditherer    string
 	imageType   string
+	retro       string
 	noDither    bool
+	columnMajor bool
 	compression int
 	numColors   int
 	commands    flag.FlagSet
@@ -34,6 +38,8 @@ var (
 
 const helper = `
 Usage of commands:
+  -column-major
+    	Process the image column by column, like the earlier versions.
   -compression int
     	JPEG compression. (default 100)
   -ditherer string
@@ -44,56 +50,56 @@ Usage of commands:
     	Output directory. (default "output")
   -palette int
     	The number of palette colors. (default 256)
+  -retro string
+    	Map the image onto a built-in hardware palette, like cga, ega64, c64, nes, gameboy, pico8, zxspectrum, apple2.
   -type string
     	Image type. Possible options .jpg, .png (default "jpg")
 `
 
 var dither map[string]colorquant.Dither = map[string]colorquant.Dither{
 	"FloydSteinberg": colorquant.Dither{
-		[][]float32{
+		Filter: [][]float32{
 			[]float32{0.0, 0.0, 0.0, 7.0 / 48.0, 5.0 / 48.0},
 			[]float32{3.0 / 48.0, 5.0 / 48.0, 7.0 / 48.0, 5.0 / 48.0, 3.0 / 48.0},
 			[]float32{1.0 / 48.0, 3.0 / 48.0, 5.0 / 48.0, 3.0 / 48.0, 1.0 / 48.0},
 		},
 	},
 	"Burkes": colorquant.Dither{
-		[][]float32{
+		Filter: [][]float32{
 			[]float32{0.0, 0.0, 0.0, 8.0 / 32.0, 4.0 / 32.0},
 			[]float32{2.0 / 32.0, 4.0 / 32.0, 8.0 / 32.0, 4.0 / 32.0, 2.0 / 32.0},
-			[]float32{0.0, 0.0, 0.0, 0.0, 0.0},
-			[]float32{4.0 / 32.0, 8.0 / 32.0, 0.0, 0.0, 0.0},
 		},
 	},
 	"Stucki": colorquant.Dither{
-		[][]float32{
+		Filter: [][]float32{
 			[]float32{0.0, 0.0, 0.0, 8.0 / 42.0, 4.0 / 42.0},
 			[]float32{2.0 / 42.0, 4.0 / 42.0, 8.0 / 42.0, 4.0 / 42.0, 2.0 / 42.0},
 			[]float32{1.0 / 42.0, 2.0 / 42.0, 4.0 / 42.0, 2.0 / 42.0, 1.0 / 42.0},
 		},
 	},
 	"Atkinson": colorquant.Dither{
-		[][]float32{
+		Filter: [][]float32{
 			[]float32{0.0, 0.0, 1.0 / 8.0, 1.0 / 8.0},
 			[]float32{1.0 / 8.0, 1.0 / 8.0, 1.0 / 8.0, 0.0},
 			[]float32{0.0, 1.0 / 8.0, 0.0, 0.0},
 		},
 	},
 	"Sierra-3": colorquant.Dither{
-		[][]float32{
+		Filter: [][]float32{
 			[]float32{0.0, 0.0, 0.0, 5.0 / 32.0, 3.0 / 32.0},
 			[]float32{2.0 / 32.0, 4.0 / 32.0, 5.0 / 32.0, 4.0 / 32.0, 2.0 / 32.0},
 			[]float32{0.0, 2.0 / 32.0, 3.0 / 32.0, 2.0 / 32.0, 0.0},
 		},
 	},
 	"Sierra-2": colorquant.Dither{
-		[][]float32{
+		Filter: [][]float32{
 			[]float32{0.0, 0.0, 0.0, 4.0 / 16.0, 3.0 / 16.0},
 			[]float32{1.0 / 16.0, 2.0 / 16.0, 3.0 / 16.0, 2.0 / 16.0, 1.0 / 16.0},
 			[]float32{0.0, 0.0, 0.0, 0.0, 0.0},
 		},
 	},
 	"Sierra-Lite": colorquant.Dither{
-		[][]float32{
+		Filter: [][]float32{
 			[]float32{0.0, 0.0, 2.0 / 4.0},
 			[]float32{1.0 / 4.0, 1.0 / 4.0, 0.0},
 			[]float32{0.0, 0.0, 0.0},
@@ -101,6 +107,26 @@ var dither map[string]colorquant.Dither = map[string]colorquant.Dither{
 	},
 }
 
+// columnMajorDither holds the kernels reproducing the output of the earlier versions in column-major mode,
+// which read the Burkes and Sierra-Lite kernels one column to the right. Burkes also had 4 rows back then.
+var columnMajorDither map[string]colorquant.Dither = map[string]colorquant.Dither{
+	"Burkes": colorquant.Dither{
+		Filter: [][]float32{
+			[]float32{0.0, 0.0, 8.0 / 32.0, 4.0 / 32.0},
+			[]float32{4.0 / 32.0, 8.0 / 32.0, 4.0 / 32.0, 2.0 / 32.0},
+			[]float32{0.0, 0.0, 0.0, 0.0},
+			[]float32{8.0 / 32.0, 0.0, 0.0, 0.0},
+		},
+	},
+	"Sierra-Lite": colorquant.Dither{
+		Filter: [][]float32{
+			[]float32{0.0, 2.0 / 4.0},
+			[]float32{1.0 / 4.0, 0.0},
+			[]float32{0.0, 0.0},
+		},
+	},
+}
+
 // Open image
 func (file *file) Open() (image.Image, error) {
 	f, err := os.Open(file.name)
@@ -118,17 +144,33 @@ func (file *file) Quantify(src image.Image, output string) (image.Image, error)
 	var err error
 	var quant image.Image
 
-	dst := image.NewPaletted(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()), palette.WebSafe)
+	// With a hardware palette the image is mapped onto its colors, instead of the quantized ones.
+	pal, useQuantizer := color.Palette(palette.WebSafe), true
+	if retro != "" {
+		p, ok := colorquant.HardwarePalette(retro)
+		if !ok {
+			log.Fatalf("\nInvalid hardware palette! Possible options: %s", strings.Join(colorquant.HardwarePalettes(), ", "))
+		}
+		pal, useQuantizer = p, false
+	}
+	dst := image.NewPaletted(image.Rect(0, 0, src.Bounds().Dx(), src.Bounds().Dy()), pal)
 	if noDither {
-		quant = colorquant.NoDither.Quantize(src, dst, numColors, false, true)
+		quant = colorquant.NoDither.Quantize(src, dst, numColors, false, useQuantizer)
 	} else {
 		if _, ok := dither[ditherer]; !ok {
 			log.Fatal("\nInvalid dithering method!")
 			return nil, err
 		}
 
-		ditherer := dither[ditherer]
-		quant = ditherer.Quantize(src, dst, numColors, true, true)
+		var quantizer colorquant.Quantizer = dither[ditherer]
+		if columnMajor {
+			d, ok := columnMajorDither[ditherer]
+			if !ok {
+				d = dither[ditherer]
+			}
+			quantizer = colorquant.ColumnMajor(d)
+		}
+		quant = quantizer.Quantize(src, dst, numColors, true, useQuantizer)
 	}
 
 	fq, err := os.Create(output)
@@ -139,7 +181,7 @@ func (file *file) Quantify(src image.Image, output string) (image.Image, error)
 
 	switch imageType {
 	case "jpg":
-		if err = jpeg.Encode(fq, quant, &jpeg.Options{compression}); err != nil {
+		if err = jpeg.Encode(fq, quant, &jpeg.Options{Quality: compression}); err != nil {
 			log.Fatal(err)
 			return nil, err
 		}
@@ -158,8 +200,10 @@ func main() {
 	commands.StringVar(&ditherer, "ditherer", "FloydSteinberg", "Dithering method.")
 	commands.StringVar(&imageType, "type", "jpg", "Image type. Possible options .jpg, .png")
 	commands.BoolVar(&noDither, "no-dither", false, "Use image quantizer without dithering.")
+	commands.BoolVar(&columnMajor, "column-major", false, "Process the image column by column, like the earlier versions.")
 	commands.IntVar(&compression, "compression", 100, "JPEG compression.")
 	commands.IntVar(&numColors, "palette", 256, "The number of palette colors.")
+	commands.StringVar(&retro, "retro", "", "Map the image onto a built-in hardware palette, like cga, ega64, c64, nes, gameboy, pico8, zxspectrum, apple2.")
 
 	if len(os.Args) <= 1 || (os.Args[1] == "--help" || os.Args[1] == "-h") {
 		fmt.Println(errors.New(helper))
@@ -178,6 +222,9 @@ func main() {
 		if numColors <= 1 {
 			log.Fatal("Color palette value cannot be less then 1")
 		}
+		if numColors > colorquant.MaxColors {
+			log.Fatalf("Color palette value cannot be greater then %d", colorquant.MaxColors)
+		}
 
 		cwd, err := filepath.Abs(filepath.Dir(input.name))
 		if err != nil {
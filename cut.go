@@ -0,0 +1,120 @@
+package colorquant
+
+// CutMethod is the rule for choosing the position a cluster is split at along its widest channel
+// (or its principal axis).
+type CutMethod int
+
+const (
+	// CutMedian splits the cluster at the median, so that both halves hold the same number of pixels.
+	CutMedian CutMethod = iota
+	// CutMean splits the cluster at the (weighted) mean value along the split axis.
+	// Outlier colors pull the mean towards them, so they are separated sooner.
+	CutMean
+	// CutVariance splits the cluster where the summed color variance of the two halves is the smallest.
+	CutVariance
+)
+
+// cutBins is the number of histogram bins the split axis is divided into by CutVariance.
+const cutBins = 256
+
+// cutPoint returns the value along the split axis the cluster is split at according to the rule of the work space.
+func (qz *Quant) cutPoint(c *cluster) uint32 {
+	switch qz.Cut {
+	case CutMean:
+		if m, ok := qz.mean(c); ok {
+			return m
+		}
+	case CutVariance:
+		return qz.minVarianceCut(c)
+	}
+	return qz.Median(c)
+}
+
+// channel returns the color at point p, and its value along the axis the cluster is split along:
+// the projection to the principal axis if set, otherwise the value of the widest channel.
+func (qz *Quant) channel(c *cluster, p point) (r, g, b, v uint32) {
+	r, g, b, _ = qz.img.At(p.x, p.y).RGBA()
+	if c.axis != ([3]float64{}) {
+		return r, g, b, project(c.axis, r, g, b)
+	}
+	switch c.widestCh {
+	case rx:
+		v = r
+	case gx:
+		v = g
+	case bx:
+		v = b
+	}
+	return
+}
+
+// mean returns the weighted mean of the values along the split axis. It fails if the points have no weight.
+func (qz *Quant) mean(c *cluster) (uint32, bool) {
+	var sum, wsum float64
+	for _, p := range c.px {
+		w := qz.weight(p)
+		_, _, _, v := qz.channel(c, p)
+		sum += w * float64(v)
+		wsum += w
+	}
+	if wsum == 0 {
+		return 0, false
+	}
+	return uint32(sum/wsum + 0.5), true
+}
+
+// minVarianceCut returns the value along the split axis which splits the cluster into two halves
+// with the smallest summed variance of the R,G,B values. The range of the values is divided into
+// histogram bins, and every bin boundary is evaluated, so the cost is linear in the number of points.
+// The minimum and the maximum fall into the first and the last bin, so there is always a boundary to cut at.
+func (qz *Quant) minVarianceCut(c *cluster) uint32 {
+	var (
+		n     [cutBins]int
+		w     [cutBins]float64
+		s, ss [cutBins][3]float64
+	)
+	for _, p := range c.px {
+		r, g, b, v := qz.channel(c, p)
+		k := int(uint64(v-c.chMin) * (cutBins - 1) / uint64(c.chRange))
+		pw := qz.weight(p)
+		n[k]++
+		w[k] += pw
+		for i, cv := range [3]float64{float64(r) / 0x101, float64(g) / 0x101, float64(b) / 0x101} {
+			s[k][i] += pw * cv
+			ss[k][i] += pw * cv * cv
+		}
+	}
+	// Sum up all the bins, then the bins below each boundary.
+	var (
+		tw, lw           float64
+		ts, tss, ls, lss [3]float64
+	)
+	for k := 0; k < cutBins; k++ {
+		tw += w[k]
+		for i := range ts {
+			ts[i] += s[k][i]
+			tss[i] += ss[k][i]
+		}
+	}
+	best, cut := -1.0, 0
+	for k := 1; k < cutBins; k++ {
+		lw += w[k-1]
+		for i := range ls {
+			ls[i] += s[k-1][i]
+			lss[i] += ss[k-1][i]
+		}
+		if n[k] == 0 {
+			continue // an empty bin gives the same split as the next boundary
+		}
+		var rs, rss [3]float64
+		for i := range rs {
+			rs[i] = ts[i] - ls[i]
+			rss[i] = tss[i] - lss[i]
+		}
+		if v := sse(lw, ls, lss) + sse(tw-lw, rs, rss); best < 0 || v < best {
+			best, cut = v, k
+		}
+	}
+	// The points in the bins below the cut are smaller than the returned value.
+	return c.chMin + uint32((uint64(cut)*uint64(c.chRange)+cutBins-2)/(cutBins-1))
+}
@@ -0,0 +1,89 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestChValues_Nth(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 1; n < 50; n++ {
+		ch := make(chValues, n)
+		for i := range ch {
+			ch[i] = uint32(rnd.Intn(8)) // many duplicates
+		}
+		sorted := append([]uint32(nil), ch...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		for k := 0; k < n; k++ {
+			buf := append(chValues(nil), ch...)
+			if v := buf.nth(k); v != sorted[k] {
+				t.Fatalf("Expected the %d-th of %d values to be %d, got %d", k, n, sorted[k], v)
+			}
+			for _, v := range buf[:k] {
+				if v > sorted[k] {
+					t.Fatalf("The values before index %d should not be greater than %d, got %d", k, sorted[k], v)
+				}
+			}
+		}
+	}
+}
+
+func TestQuant_MedianMatchesSort(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	img := image.NewGray(image.Rect(0, 0, 7, 6))
+	rnd.Read(img.Pix)
+	for _, n := range []int{41, 42} {
+		qz := newQuantizer(img, 1)
+		c := &qz.cs[0]
+		c.px = c.px[:n]
+		qz.setColorRange(c)
+
+		vals := make([]uint32, n)
+		for i, p := range c.px {
+			vals[i], _, _, _ = img.At(p.x, p.y).RGBA()
+		}
+		sort.Slice(vals, func(i, j int) bool { return vals[i] < vals[j] })
+		want := vals[n/2]
+		if n%2 == 0 {
+			want = (want + vals[n/2-1]) / 2
+		}
+		if m := qz.Median(c); m != want {
+			t.Errorf("Expected the median of %d values to be %d, got %d", n, want, m)
+		}
+	}
+}
+
+func TestQuant_Cut(t *testing.T) {
+	// Mostly dark pixels with a few white outliers.
+	img := image.NewGray(image.Rect(0, 0, 100, 1))
+	for x := range img.Pix {
+		switch {
+		case x < 60:
+			img.Pix[x] = 0
+		case x < 90:
+			img.Pix[x] = 20
+		default:
+			img.Pix[x] = 0xff
+		}
+	}
+	hasWhite := func(p color.Palette) bool {
+		for _, c := range p {
+			if r, _, _, _ := c.RGBA(); r == 0xffff {
+				return true
+			}
+		}
+		return false
+	}
+	for _, cut := range []CutMethod{CutMean, CutVariance} {
+		p := Quant{Cut: cut}.Quantize(img, 2).(*image.Paletted)
+		if !hasWhite(p.Palette) {
+			t.Errorf("The cut method %d should preserve the outlier color, got %v", cut, p.Palette)
+		}
+	}
+	if p := (Quant{}).Quantize(img, 2).(*image.Paletted); hasWhite(p.Palette) {
+		t.Error("The median cut is expected to merge the outliers with the dark pixels")
+	}
+}
@@ -0,0 +1,126 @@
+package colorquant
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// noisy returns an image with random colors, many of them repeated, to exercise the ties.
+func noisy(seed int64, w, h int) *image.RGBA {
+	rnd := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i] = uint8(rnd.Intn(8) * 32)
+		img.Pix[i+1] = uint8(rnd.Intn(256))
+		img.Pix[i+2] = uint8(rnd.Intn(4) * 64)
+		img.Pix[i+3] = 0xff
+	}
+	return img
+}
+
+func TestQuant_Deterministic(t *testing.T) {
+	img := noisy(1, 48, 32)
+	weights := image.NewGray(img.Bounds())
+	for i := range weights.Pix {
+		weights.Pix[i] = uint8(i * 7)
+	}
+	options := []Quant{
+		{},
+		{Priority: ByVariance, Cut: CutVariance},
+		{Priority: ByPopulationVolume, Cut: CutMean, Weights: weights},
+		{PrincipalAxis: true},
+		{Fixed: color.Palette{color.RGBA{0, 0, 0, 0xff}, color.RGBA{0xff, 0xff, 0xff, 0xff}}, FixedTolerance: 20},
+	}
+	for i, q := range options {
+		first := q.Quantize(img, 32).(*image.Paletted)
+		// The results should also be the same when quantizing concurrently.
+		var wg sync.WaitGroup
+		results := make([]*image.Paletted, 8)
+		for j := range results {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				results[j] = q.Quantize(img, 32).(*image.Paletted)
+			}(j)
+		}
+		wg.Wait()
+		for _, res := range results {
+			if !reflect.DeepEqual(first.Palette, res.Palette) {
+				t.Errorf("Options %d: the palette differs between runs", i)
+			}
+			if !bytes.Equal(first.Pix, res.Pix) {
+				t.Errorf("Options %d: the pixel indices differ between runs", i)
+			}
+		}
+	}
+}
+
+func TestQuant_DeterministicRepresentation(t *testing.T) {
+	// The same colors in a different image type give the same result.
+	img := noisy(2, 32, 32)
+	nrgba := image.NewNRGBA(img.Bounds())
+	copy(nrgba.Pix, img.Pix)
+
+	a := Quant{}.Quantize(img, 16).(*image.Paletted)
+	b := Quant{}.Quantize(nrgba, 16).(*image.Paletted)
+	if !reflect.DeepEqual(a.Palette, b.Palette) || !bytes.Equal(a.Pix, b.Pix) {
+		t.Error("The result should not depend on the image representation")
+	}
+}
+
+func TestDither_Deterministic(t *testing.T) {
+	img := noisy(3, 32, 32)
+	p := Quant{}.Quantize(img, 8).(*image.Paletted)
+	ditherers := []Quantizer{
+		Dither{Filter: [][]float32{
+			{0, 0, 7.0 / 16},
+			{3.0 / 16, 5.0 / 16, 1.0 / 16},
+		}},
+		PatternDither{Size: 4},
+		VariableDither{Levels: 4, Modulation: true, Seed: 42},
+	}
+	for i, d := range ditherers {
+		var prev *image.Paletted
+		for run := 0; run < 3; run++ {
+			dst := image.NewPaletted(img.Bounds(), p.Palette)
+			d.Quantize(img, dst, 8, true, false)
+			if prev != nil && !bytes.Equal(prev.Pix, dst.Pix) {
+				t.Errorf("Ditherer %d: the output differs between runs", i)
+			}
+			prev = dst
+		}
+	}
+}
+
+func TestVariableDither_Seed(t *testing.T) {
+	img := noisy(4, 32, 32)
+	run := func(seed int64) []uint8 {
+		dst := image.NewGray(img.Bounds())
+		VariableDither{Gray: true, Modulation: true, Seed: seed}.Quantize(img, dst, 0, true, false)
+		return dst.Pix
+	}
+	if !bytes.Equal(run(1), run(1)) {
+		t.Error("The output should be reproducible for the same seed")
+	}
+	if bytes.Equal(run(1), run(2)) {
+		t.Error("The output is expected to depend on the seed")
+	}
+}
+
+func TestMixingPlan_Ties(t *testing.T) {
+	// Red and blue alternate in the plan of purple, with the same luminance
+	// they end up sorted by palette index.
+	palette := [][4]int32{{0xffff, 0, 0, 0xffff}, {0, 0, 0xffff, 0xffff}}
+	tree := newKDTree(palette, rgbaWeights)
+	luma := []int32{100, 100}
+	plan := make([]int, 4)
+	mixingPlan(plan, tree, palette, luma, 0x8000, 0, 0x8000, 0xffff, 1)
+	if want := []int{0, 0, 1, 1}; !reflect.DeepEqual(plan, want) {
+		t.Errorf("Expected the plan %v, got %v", want, plan)
+	}
+}
@@ -3,18 +3,54 @@ package colorquant
 import (
 	"image"
 	"image/color"
-	"math"
 	"image/draw"
 )
 
 // Dither is a two dimensional slice for storing different dithering methods.
 type Dither struct {
+	// Filter holds the error diffusion weights. The first row belongs to the current row
+	// of the image, the center column (at index (len(row)-1)/2) to the current pixel.
+	// The image is processed row by row, from left to right, diffusing the error
+	// to the right and to the rows below.
 	Filter [][]float32
 }
 
+// ColumnMajor is an error diffusion ditherer which processes the image column by column,
+// from top to bottom, with the transposed filter coordinates of the earlier versions of the
+// library. It's kept for compatibility. The current pixel is at index len(row)/2 of the first
+// row, so the output of the earlier versions is reproduced for the filters of len(row)/2+1 rows.
+type ColumnMajor Dither
+
 // NoDither is used to call the default quantize method without applying dithering.
 var NoDither Quantizer = Dither{}
 
+// FloydSteinberg is the classic Floyd-Steinberg error diffusion kernel.
+var FloydSteinberg = Dither{
+	Filter: [][]float32{
+		{0, 0, 7.0 / 16},
+		{3.0 / 16, 5.0 / 16, 1.0 / 16},
+	},
+}
+
+// Atkinson is Bill Atkinson's error diffusion kernel. It diffuses only 3/4 of the error,
+// which gives crisper, more contrasted output, well suited for text and line art.
+var Atkinson = Dither{
+	Filter: [][]float32{
+		{0, 0, 0, 1.0 / 8, 1.0 / 8},
+		{0, 1.0 / 8, 1.0 / 8, 1.0 / 8, 0},
+		{0, 0, 1.0 / 8, 0, 0},
+	},
+}
+
+// clone returns a copy of the ditherer with its own filter, which can be modified freely.
+func (dither Dither) clone() Dither {
+	filter := make([][]float32, len(dither.Filter))
+	for i, row := range dither.Filter {
+		filter[i] = append([]float32(nil), row...)
+	}
+	return Dither{filter}
+}
+
 // Empty check if dither struct is empty. If empty this means we are not using any dithering method.
 func (dither Dither) Empty() bool {
 	if len(dither.Filter) > 0 {
@@ -24,229 +60,228 @@ func (dither Dither) Empty() bool {
 }
 
 // Quantize takes as parameter the original image and returns the processed image with or without dithering applied.
+// Without the quantizer the pixels are mapped to the palette of dst if it's an *image.Paletted,
+// otherwise to the colors of its color model.
 func (dither Dither) Quantize(src image.Image, dst draw.Image, nq int, useDither bool, useQuantizer bool) image.Image {
-	var quant image.Image
-	var er, eg, eb, ea int32
-	dx, dy := src.Bounds().Dx(), src.Bounds().Dy()
+	return dither.quantize(src, dst, nq, useDither, useQuantizer, false)
+}
 
-	// Import the quantized image and specify the quantization level
-	if useQuantizer {
-		quant = Quant{}.Quantize(src, nq)
-	}
+// Quantize is like Dither.Quantize, processing the image column by column.
+func (dither ColumnMajor) Quantize(src image.Image, dst draw.Image, nq int, useDither bool, useQuantizer bool) image.Image {
+	return Dither(dither).quantize(src, dst, nq, useDither, useQuantizer, true)
+}
 
-	// Prepopulate a multidimensional slice. We will use this to store the quantization level.
-	rErr := make([][]float32, dx)
-	gErr := make([][]float32, dx)
-	bErr := make([][]float32, dx)
-	for x := 0; x < dx; x++ {
-		rErr[x]	= make([]float32, dy)
-		gErr[x]	= make([]float32, dy)
-		bErr[x]	= make([]float32, dy)
-		for y := 0; y < dy; y++ {
-			rErr[x][y] = 0
-			gErr[x][y] = 0
-			bErr[x][y] = 0
-		}
+func (dither Dither) quantize(src image.Image, dst draw.Image, nq int, useDither, useQuantizer, columnMajor bool) image.Image {
+	db := dst.Bounds()
+
+	if p, ok := dst.(*image.Paletted); ok && !useQuantizer {
+		// If dst is an *image.Paletted, we have a fast path for dst.Set and dst.At.
+		palette := paletteValues(p.Palette)
+		tree := newKDTree(palette, rgbaWeights)
+		pix, stride := p.Pix[p.PixOffset(db.Min.X, db.Min.Y):], p.Stride
+
+		dither.scan(src, useDither, columnMajor, func(x, y int, r, g, b, a int32) (int32, int32, int32) {
+			// Find the closest palette color in Euclidean R,G,B,A space:
+			// the one that minimizes sum-squared-difference.
+			bestIndex := tree.nearest(r, g, b, a)
+			pix[y*stride+x] = byte(bestIndex)
+			return palette[bestIndex][0], palette[bestIndex][1], palette[bestIndex][2]
+		})
+		return dst
 	}
 
-	// If dst is an *image.Paletted, we have a fast path for dst.Set and dst.At.
-	palette, pix, stride := [][4]int32(nil), []byte(nil), 0
-	if p, ok := dst.(*image.Paletted); ok {
-		palette = make([][4]int32, len(p.Palette))
-		for i, col := range p.Palette {
-			r, g, b, a := col.RGBA()
-			palette[i][0] = int32(r)
-			palette[i][1] = int32(g)
-			palette[i][2] = int32(b)
-			palette[i][3] = int32(a)
-		}
-		pix, stride = p.Pix[p.PixOffset(0, 0):], p.Stride
+	// Otherwise the pixels are mapped by the color model of dst, after mapping them
+	// to the closest colors of the quantized image if the quantizer is used.
+	img := src
+	if useQuantizer {
+		// Import the quantized image and specify the quantization level.
+		// The closest colors of the quantized image are looked up in a k-d tree.
+		qpal := paletteOf(Quant{}.Quantize(src, nq))
+		img = quantColors{src, qpal, newPaletteTree(qpal, lumaWeights)}
 	}
+	out := color.RGBA{A: 0xff}
 
-	out := color.RGBA{A:0xff}
+	dither.scan(img, useDither, columnMajor, func(x, y int, r, g, b, a int32) (int32, int32, int32) {
+		out.R = uint8(r >> 8)
+		out.G = uint8(g >> 8)
+		out.B = uint8(b >> 8)
+		out.A = uint8(a >> 8)
 
-	// Loop through the image and process each pixel individually.
-	for x := 0; x != dx; x++ {
-		for y := 0; y != dy; y++ {
-			if !useQuantizer {
-				r1, g1, b1, a1 := src.At(x, y).RGBA()
-				// er, eg and eb are the pixel's R,G,B values
-				er, eg, eb, ea = int32(r1), int32(g1), int32(b1), int32(a1)
-
-				if useDither {
-					er = clamp(er + int32(rErr[x][y] * 1.12))
-					eg = clamp(eg + int32(gErr[x][y] * 1.12))
-					eb = clamp(eb + int32(bErr[x][y] * 1.12))
-				}
+		// Set the resulting pixel colors in the destination image.
+		dst.Set(db.Min.X+x, db.Min.Y+y, &out)
+		sr, sg, sb, _ := dst.At(db.Min.X+x, db.Min.Y+y).RGBA()
+		return int32(sr), int32(sg), int32(sb)
+	})
+	return dst
+}
 
-				// Find the closest palette color in Euclidean R,G,B,A space:
-				// the one that minimizes sum-squared-difference.
-				bestIndex, bestSum := 0, uint32(1<<32-1)
-				for index, p := range palette {
-					sum := sqDiff(er, p[0]) + sqDiff(eg, p[1]) + sqDiff(eb, p[2]) + sqDiff(ea, p[3])
-					if sum < bestSum {
-						bestIndex, bestSum = index, sum
-						if sum == 0 {
-							break
-						}
-					}
-				}
-				pix[y*stride+x] = byte(bestIndex)
+// quantColors is an image which maps the source pixels to their closest colors of the quantized palette.
+type quantColors struct {
+	image.Image
+	palette color.Palette
+	tree    *kdTree
+}
 
-				if !useDither {
-					continue
-				}
-				er -= palette[bestIndex][0]
-				eg -= palette[bestIndex][1]
-				eb -= palette[bestIndex][2]
-				ea -= palette[bestIndex][3]
-
-				// Diffuse error in two dimension
-				ydim := len(dither.Filter) - 1
-				xdim := len(dither.Filter[0]) / 2 // split the X dimension in two halves
-				for xx := 0; xx < ydim + 1; xx++ {
-					for yy := -xdim; yy <= xdim - 1; yy++ {
-						if y + yy < 0 || dy <= y + yy || x + xx < 0 || dx <= x + xx {
-							continue
-						}
-						// Propagate the quantization error
-						rErr[x+xx][y+yy] += float32(er) * dither.Filter[xx][yy + ydim]
-						gErr[x+xx][y+yy] += float32(eg) * dither.Filter[xx][yy + ydim]
-						bErr[x+xx][y+yy] += float32(eb) * dither.Filter[xx][yy + ydim]
-					}
-				}
-			} else {
-				// Find the closest pixel color between the paletted image and the original image.
-				r1, g1, b1, a1 := findClosestColor(quant.(*image.Paletted), src.At(x, y)).RGBA()
-				// er, eg and eb are the pixel's R,G,B values
-				er, eg, eb, ea := int32(r1), int32(g1), int32(b1), int32(a1)
-
-				if useDither && !dither.Empty() {
-					er = clamp(er + int32(rErr[x][y] * 1.12))
-					eg = clamp(eg + int32(gErr[x][y] * 1.12))
-					eb = clamp(eb + int32(bErr[x][y] * 1.12))
-				}
-				out.R = uint8(er>>8)
-				out.G = uint8(eg>>8)
-				out.B = uint8(eb>>8)
-				out.A = uint8(ea>>8)
+func (q quantColors) At(x, y int) color.Color {
+	return findClosestColor(q.palette, q.tree, q.Image.At(x, y))
+}
 
-				// Set the resulting pixel colors in the destination image.
-				dst.Set(x, y, &out)
+// diffuse traverses the source image row by row. For every pixel it calls the quantize function
+// with the pixel coordinates relative to the image origin and the pixel color adjusted by the error
+// accumulated so far. The quantize function returns the color the pixel has been mapped to,
+// and the difference between the two is propagated to the neighbouring pixels.
+func (dither Dither) diffuse(src image.Image, useDither bool, quantize func(x, y int, r, g, b, a int32) (int32, int32, int32)) {
+	dither.scan(src, useDither, false, quantize)
+}
 
-				if !useDither || dither.Empty() {
-					continue
-				}
-				sr, sg, sb, sa := dst.At(x, y).RGBA()
-				er -= int32(sr)
-				eg -= int32(sg)
-				eb -= int32(sb)
-				ea -= int32(sa)
-
-				// Diffuse error in two dimension
-				ydim := len(dither.Filter) - 1
-				xdim := len(dither.Filter[0]) / 2 // split the X dimension in two halves
-				for xx := 0; xx < ydim + 1; xx++ {
-					for yy := -xdim; yy <= xdim - 1; yy++ {
-						if y + yy < 0 || dy <= y + yy || x + xx < 0 || dx <= x + xx {
-							continue
-						}
-						// Propagate the quantization error
-						rErr[x+xx][y+yy] += float32(er) * dither.Filter[xx][yy + ydim]
-						gErr[x+xx][y+yy] += float32(eg) * dither.Filter[xx][yy + ydim]
-						bErr[x+xx][y+yy] += float32(eb) * dither.Filter[xx][yy + ydim]
-					}
-				}
+// scan is like diffuse, traversing the image column by column if columnMajor is set.
+func (dither Dither) scan(src image.Image, useDither, columnMajor bool, quantize func(x, y int, r, g, b, a int32) (int32, int32, int32)) {
+	b := src.Bounds()
+	dx, dy := b.Dx(), b.Dy()
+	useDither = useDither && !dither.Empty()
+
+	outer, inner := dy, dx
+	if columnMajor {
+		outer, inner = dx, dy
+	}
+	// The quantization error is stored in a rolling buffer, which holds only the lines
+	// the dithering kernel can still reach, instead of the whole image.
+	errs := newErrorRows(len(dither.Filter), inner)
+
+	// Loop through the image and process each pixel individually.
+	for o := 0; o < outer; o++ {
+		// The previous line cannot be reached anymore, reuse it for the next ones.
+		if o > 0 {
+			errs.reset(o - 1)
+		}
+		for i := 0; i < inner; i++ {
+			x, y := i, o
+			if columnMajor {
+				x, y = o, i
+			}
+			r1, g1, b1, a1 := src.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			// er, eg and eb are the pixel's R,G,B values
+			er, eg, eb, ea := int32(r1), int32(g1), int32(b1), int32(a1)
+
+			if useDither {
+				re, ge, be := errs.at(o, i)
+				er = clamp(er + int32(re*1.12))
+				eg = clamp(eg + int32(ge*1.12))
+				eb = clamp(eb + int32(be*1.12))
+			}
+			qr, qg, qb := quantize(x, y, er, eg, eb, ea)
+
+			if !useDither {
+				continue
 			}
+			dither.spread(errs, columnMajor, o, i, outer, inner, float32(er-qr), float32(eg-qg), float32(eb-qb))
 		}
 	}
-	return dst
 }
 
-// Returns the index of the palette color closest to source color in Euclidean R,G,B,A space.
-func findClosestColor(palette *image.Paletted, src color.Color) color.Color {
-	var pr, pg, pb, pa float64
-	if len(palette.Palette) == 0 {
-		return nil
-	}
-	cr, cg, cb, ca := src.RGBA()
-	idx, bestSum := 0, uint32(1<<32-1)
-
-	// Rec. 709 (sRGB) luma coef.
-	pr = .2126
-	pg = .7152
-	pb = .0722
-	pa = 1.0
-
-	// Get the square root of euclidean distance.
-	euclMax := math.Sqrt(pr * 255 * 255 + pg * 255 * 255 + pb * 255 * 255)
-	for index, v := range palette.Palette {
-		vr, vg, vb, va := v.RGBA()
-		// Get the color distance.
-		sum := math.Sqrt(
-			pr * sqDiffFloat(float64(cr), float64(vr)) +
-			pg * sqDiffFloat(float64(cg), float64(vg)) +
-			pb * sqDiffFloat(float64(cb), float64(vb)) +
-			pa * sqDiffFloat(float64(ca), float64(va))) / euclMax
-		// Get the min value.
-		if uint32(sum) < bestSum {
-			idx, bestSum = index, uint32(sum)
-			if sum == 0 {
+// spread propagates the quantization error of the pixel at position i of line o to its neighbours.
+func (dither Dither) spread(errs *errorRows, columnMajor bool, o, i, outer, inner int, er, eg, eb float32) {
+	if columnMajor {
+		// Diffuse error in two dimension, using the original transposed coordinates.
+		xdim := len(dither.Filter[0]) / 2 // split the X dimension in two halves
+		for xx, weights := range dither.Filter {
+			if outer <= o+xx {
 				break
 			}
+			for yy := -xdim; yy <= xdim-1; yy++ {
+				// Skip the kernel cells outside of the row.
+				col := yy + xdim
+				if col >= len(weights) || i+yy < 0 || inner <= i+yy {
+					continue
+				}
+				// Propagate the quantization error
+				errs.add(o+xx, i+yy, er, eg, eb, weights[col])
+			}
+		}
+		return
+	}
+	for row, weights := range dither.Filter {
+		if outer <= o+row {
+			break
+		}
+		center := (len(weights) - 1) / 2
+		for col, w := range weights {
+			dx := col - center
+			// Pixels of the current row up to the current one have already been processed.
+			if w == 0 || (row == 0 && dx <= 0) || i+dx < 0 || inner <= i+dx {
+				continue
+			}
+			errs.add(o+row, i+dx, er, eg, eb, w)
 		}
 	}
-	// Return the colors most closely identical to the original pixel colors.
-	return palette.Palette[idx]
 }
 
-// clamp clamps i to the interval [0, 0xffff].
-func clamp(i int32) int32 {
-	if i < 0 {
-		return 0
+// errorRows is a rolling buffer storing the diffused quantization error of each channel.
+// It holds as many lines as the height of the dithering kernel, so the memory usage
+// depends only on the kernel size and the line length, not on the image size.
+type errorRows struct {
+	r, g, b [][]float32
+}
+
+// newErrorRows creates a rolling error buffer with the given number of lines and line length.
+func newErrorRows(lines, length int) *errorRows {
+	if lines < 1 {
+		lines = 1
 	}
-	if i > 0xffff {
-		return 0xffff
+	e := &errorRows{
+		r: make([][]float32, lines),
+		g: make([][]float32, lines),
+		b: make([][]float32, lines),
 	}
-	return i
+	for i := 0; i < lines; i++ {
+		e.r[i] = make([]float32, length)
+		e.g[i] = make([]float32, length)
+		e.b[i] = make([]float32, length)
+	}
+	return e
 }
 
-// sqDiffFloat returns the squared-difference of X and Y.
-func sqDiffFloat(x, y float64) float64 {
-	var d float64
+// at returns the accumulated error at position i of the n-th line.
+func (e *errorRows) at(n, i int) (float32, float32, float32) {
+	k := n % len(e.r)
+	return e.r[k][i], e.g[k][i], e.b[k][i]
+}
 
-	if x > y {
-		d = float64(x - y)
-	} else {
-		d = float64(x - y)
-	}
-	return float64(d * d)
+// add propagates the weighted error to position i of the n-th line.
+func (e *errorRows) add(n, i int, er, eg, eb, weight float32) {
+	k := n % len(e.r)
+	e.r[k][i] += er * weight
+	e.g[k][i] += eg * weight
+	e.b[k][i] += eb * weight
 }
 
-// sqDiff returns the squared-difference of X and Y.
-func sqDiff(x, y int32) uint32 {
-	var d uint32
-	if x > y {
-		d = uint32(x - y)
-	} else {
-		d = uint32(y - x)
+// reset clears the n-th line, so that it can be reused for a following line.
+func (e *errorRows) reset(n int) {
+	k := n % len(e.r)
+	for i := range e.r[k] {
+		e.r[k][i] = 0
+		e.g[k][i] = 0
+		e.b[k][i] = 0
 	}
-	return (d * d) >> 2
 }
 
-
-// min returns the smallest number between two numbers.
-func min(x, y uint32) uint32 {
-	if x < y {
-		return x
+// findClosestColor returns the palette color closest to the source color in Euclidean R,G,B,A space,
+// where the color channels are weighted by their luma coefficients.
+func findClosestColor(palette color.Palette, tree *kdTree, src color.Color) color.Color {
+	if len(palette) == 0 {
+		return nil
 	}
-	return y
+	cr, cg, cb, ca := src.RGBA()
+	return palette[tree.nearest(int32(cr), int32(cg), int32(cb), int32(ca))]
 }
 
-// max returns the biggest number between two numbers.
-func max(x, y uint32) uint32 {
-	if x > y {
-		return x
+// clamp clamps i to the interval [0, 0xffff].
+func clamp(i int32) int32 {
+	if i < 0 {
+		return 0
 	}
-	return y
-}
\ No newline at end of file
+	if i > 0xffff {
+		return 0xffff
+	}
+	return i
+}
@@ -83,4 +83,157 @@ func Test_PalettedImage(t *testing.T) {
 	if palette == nil {
 		t.Error("Destination image should be of paletted type!")
 	}
-}
\ No newline at end of file
+}
+
+func Test_ErrorRows(t *testing.T) {
+	errs := newErrorRows(3, 4)
+	errs.add(5, 1, 1, 2, 3, 0.5)
+	if r, g, b := errs.at(5, 1); r != 0.5 || g != 1 || b != 1.5 {
+		t.Errorf("Unexpected accumulated error R:%f G:%f B:%f", r, g, b)
+	}
+	// Line 5 and line 2 share the same slot of the rolling buffer.
+	errs.reset(2)
+	if r, g, b := errs.at(5, 1); r != 0 || g != 0 || b != 0 {
+		t.Errorf("The error should be cleared after reset, got R:%f G:%f B:%f", r, g, b)
+	}
+}
+
+func Test_DitherPreservesIntensity(t *testing.T) {
+	ditherer := Dither{
+		[][]float32{
+			[]float32{0.0, 0.0, 0.0, 7.0 / 48.0, 5.0 / 48.0},
+			[]float32{3.0 / 48.0, 5.0 / 48.0, 7.0 / 48.0, 5.0 / 48.0, 3.0 / 48.0},
+			[]float32{1.0 / 48.0, 3.0 / 48.0, 5.0 / 48.0, 3.0 / 48.0, 1.0 / 48.0},
+		},
+	}
+	src := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range src.Pix {
+		src.Pix[i] = 0x60
+	}
+	dst := image.NewPaletted(src.Bounds(), color.Palette{color.Black, color.White})
+	ditherer.Quantize(src, dst, 2, true, false)
+
+	var white int
+	for _, idx := range dst.Pix {
+		white += int(idx)
+	}
+	if ratio := float64(white) / float64(len(dst.Pix)); ratio < 0.3 || ratio > 0.45 {
+		t.Errorf("The ratio of white pixels should be close to %.2f, got %.2f", float64(0x60)/0xff, ratio)
+	}
+}
+
+func Test_ScanOrder(t *testing.T) {
+	// Diffuse the whole error to the right neighbour of the processed pixel.
+	ditherer := Dither{
+		[][]float32{
+			[]float32{0.0, 0.0, 1.0},
+		},
+	}
+	src := image.NewGray(image.Rect(0, 0, 8, 1))
+	for i := range src.Pix {
+		src.Pix[i] = 0x80
+	}
+	dst := image.NewPaletted(src.Bounds(), color.Palette{color.Black, color.White})
+	ditherer.Quantize(src, dst, 2, true, false)
+
+	for i := 1; i < len(dst.Pix); i++ {
+		if dst.Pix[i] == dst.Pix[i-1] {
+			t.Fatalf("Row major scanning should produce alternating pixels, got %v", dst.Pix)
+		}
+	}
+
+	ditherer.Filter = [][]float32{
+		[]float32{0.0, 0.0, 0.0, 7.0 / 48.0, 5.0 / 48.0},
+		[]float32{3.0 / 48.0, 5.0 / 48.0, 7.0 / 48.0, 5.0 / 48.0, 3.0 / 48.0},
+		[]float32{1.0 / 48.0, 3.0 / 48.0, 5.0 / 48.0, 3.0 / 48.0, 1.0 / 48.0},
+	}
+	src = image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range src.Pix {
+		src.Pix[i] = 0x80
+	}
+	dst = image.NewPaletted(src.Bounds(), color.Palette{color.Black, color.White})
+	ColumnMajor(ditherer).Quantize(src, dst, 2, true, false)
+
+	var white int
+	for _, idx := range dst.Pix {
+		white += int(idx)
+	}
+	if white == 0 || white == len(dst.Pix) {
+		t.Errorf("Column major scanning should still diffuse the error, got %d white pixels", white)
+	}
+}
+
+func Test_ColumnMajorKernels(t *testing.T) {
+	// Kernels wider than their height plus one must not index outside of the filter rows.
+	kernels := map[string][][]float32{
+		"Burkes": {
+			{0.0, 0.0, 0.0, 8.0 / 32.0, 4.0 / 32.0},
+			{2.0 / 32.0, 4.0 / 32.0, 8.0 / 32.0, 4.0 / 32.0, 2.0 / 32.0},
+		},
+		"Atkinson": {
+			{0.0, 0.0, 0.0, 1.0 / 8.0, 1.0 / 8.0},
+			{0.0, 1.0 / 8.0, 1.0 / 8.0, 1.0 / 8.0, 0.0},
+			{0.0, 0.0, 1.0 / 8.0, 0.0, 0.0},
+		},
+		"Sierra-Lite": {
+			{0.0, 0.0, 2.0 / 4.0},
+			{1.0 / 4.0, 1.0 / 4.0, 0.0},
+		},
+		"Single row": {
+			{0.0, 0.0, 0.0, 1.0 / 2.0, 1.0 / 2.0},
+		},
+	}
+	src := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range src.Pix {
+		src.Pix[i] = 0x80
+	}
+	for name, filter := range kernels {
+		dst := image.NewPaletted(src.Bounds(), color.Palette{color.Black, color.White})
+		ColumnMajor{filter}.Quantize(src, dst, 2, true, false)
+
+		var white int
+		for _, idx := range dst.Pix {
+			white += int(idx)
+		}
+		if white == 0 || white == len(dst.Pix) {
+			t.Errorf("%s: column major scanning should diffuse the error, got %d white pixels", name, white)
+		}
+	}
+}
+
+// bilevel is a grayscale image storing only black and white pixels.
+type bilevel struct{ *image.Gray }
+
+func (b bilevel) Set(x, y int, c color.Color) {
+	if color.GrayModel.Convert(c).(color.Gray).Y >= 0x80 {
+		b.Gray.Set(x, y, color.White)
+	} else {
+		b.Gray.Set(x, y, color.Black)
+	}
+}
+
+func Test_ColorModelDestination(t *testing.T) {
+	ditherer := Dither{
+		[][]float32{
+			[]float32{0.0, 0.0, 7.0 / 16.0},
+			[]float32{3.0 / 16.0, 5.0 / 16.0, 1.0 / 16.0},
+		},
+	}
+	src := image.NewGray(image.Rect(0, 0, 64, 64))
+	for i := range src.Pix {
+		src.Pix[i] = 0x60
+	}
+	// Without the quantizer, a destination which is not paletted is dithered through its color model.
+	dst := bilevel{image.NewGray(src.Bounds())}
+	ditherer.Quantize(src, dst, 2, true, false)
+
+	var white int
+	for _, v := range dst.Pix {
+		if v == 0xff {
+			white++
+		}
+	}
+	if ratio := float64(white) / float64(len(dst.Pix)); ratio < 0.3 || ratio > 0.45 {
+		t.Errorf("The ratio of white pixels should be close to %.2f, got %.2f", float64(0x60)/0xff, ratio)
+	}
+}
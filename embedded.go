@@ -0,0 +1,229 @@
+package colorquant
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"unicode"
+)
+
+// PixelFormat is a raw pixel format of embedded displays.
+type PixelFormat int
+
+const (
+	// RGB565 stores a pixel in 16 bits: 5 bits of red, 6 bits of green and 5 bits of blue.
+	RGB565 PixelFormat = iota
+	// RGB555 stores a pixel in 16 bits: 5 bits of each channel, the top bit is unused.
+	RGB555
+	// RGB332 stores a pixel in 8 bits: 3 bits of red, 3 bits of green and 2 bits of blue.
+	RGB332
+)
+
+// ErrBitDepth is returned when packing the indices with an unsupported number of bits per pixel.
+var ErrBitDepth = errors.New("colorquant: the bits per pixel should be 1, 2, 4 or 8")
+
+// ErrIdentifier is returned when an array name of the generated source is not a valid identifier.
+var ErrIdentifier = errors.New("colorquant: invalid identifier")
+
+// ErrEmptyArray is returned when an array of a C header has no data, since C has no zero-length arrays.
+var ErrEmptyArray = errors.New("colorquant: a C array should hold at least one byte")
+
+// bits returns the number of bits of the R, G and B channels.
+func (f PixelFormat) bits() [3]int {
+	switch f {
+	case RGB555:
+		return [3]int{5, 5, 5}
+	case RGB332:
+		return [3]int{3, 3, 2}
+	}
+	return [3]int{5, 6, 5}
+}
+
+// Posterize returns a posterizer producing exactly the colors of the pixel format,
+// so that the dithering can target the reduced bit depth directly.
+func (f PixelFormat) Posterize() Posterize {
+	b := f.bits()
+	return PosterizeBits(b[0], b[1], b[2])
+}
+
+// pack returns the color in the pixel format. The channels are rounded to the nearest level.
+func (f PixelFormat) pack(c color.Color) uint16 {
+	b := f.bits()
+	r, g, bl, _ := c.RGBA()
+	var v uint16
+	for i, ch := range [3]uint32{r, g, bl} {
+		max := uint32(1)<<uint(b[i]) - 1
+		v = v<<uint(b[i]) | uint16((ch*max+0x7fff)/0xffff)
+	}
+	return v
+}
+
+// EncodePixels returns the pixels of the image in the raw pixel format, row by row.
+// The 16 bit formats are stored in the given byte order, most displays expect big endian.
+func EncodePixels(img image.Image, f PixelFormat, order binary.ByteOrder) []byte {
+	b := img.Bounds()
+	size := 2
+	if f == RGB332 {
+		size = 1
+	}
+	buf := make([]byte, 0, b.Dx()*b.Dy()*size)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			buf = appendPixel(buf, f.pack(img.At(x, y)), size, order)
+		}
+	}
+	return buf
+}
+
+// EncodeColors returns the palette colors in the raw pixel format, to be shipped along the packed indices.
+func EncodeColors(p color.Palette, f PixelFormat, order binary.ByteOrder) []byte {
+	size := 2
+	if f == RGB332 {
+		size = 1
+	}
+	buf := make([]byte, 0, len(p)*size)
+	for _, c := range p {
+		buf = appendPixel(buf, f.pack(c), size, order)
+	}
+	return buf
+}
+
+func appendPixel(buf []byte, v uint16, size int, order binary.ByteOrder) []byte {
+	if size == 1 {
+		return append(buf, byte(v))
+	}
+	var b [2]byte
+	order.PutUint16(b[:], v)
+	return append(buf, b[:]...)
+}
+
+// PackIndices returns the palette indices of the image packed with 1, 2, 4 or 8 bits per pixel,
+// the leftmost pixel in the most significant bits. Every row starts on a byte boundary.
+// It returns ErrTooManyColors if an index doesn't fit in the bits per pixel.
+func PackIndices(img *image.Paletted, bpp int) ([]byte, error) {
+	if bpp != 1 && bpp != 2 && bpp != 4 && bpp != 8 {
+		return nil, ErrBitDepth
+	}
+	b := img.Bounds()
+	stride := (b.Dx()*bpp + 7) / 8
+	buf := make([]byte, stride*b.Dy())
+	ppb := 8 / bpp // pixels per byte
+	for y := 0; y < b.Dy(); y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, b.Min.Y+y):img.PixOffset(b.Max.X, b.Min.Y+y)]
+		for x, i := range row {
+			if int(i) >= 1<<uint(bpp) {
+				return nil, ErrTooManyColors
+			}
+			shift := uint(8 - bpp*(x%ppb+1))
+			buf[y*stride+x/ppb] |= i << shift
+		}
+	}
+	return buf, nil
+}
+
+// Array is a named byte array of a generated source file.
+type Array struct {
+	Name string
+	Data []byte
+}
+
+// WriteC writes the arrays as the static constant uint8_t arrays of a C header,
+// so that the header can be included from several translation units.
+// Nothing is written if an array name is not a valid identifier, or if an array is empty.
+func WriteC(w io.Writer, arrays ...Array) error {
+	if err := checkNames(arrays); err != nil {
+		return err
+	}
+	for _, a := range arrays {
+		if len(a.Data) == 0 {
+			return ErrEmptyArray
+		}
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "// Generated by colorquant.\n#pragma once\n\n#include <stdint.h>\n")
+	for _, a := range arrays {
+		fmt.Fprintf(bw, "\nstatic const uint8_t %s[%d] = {\n", a.Name, len(a.Data))
+		writeBytes(bw, a.Data)
+		fmt.Fprint(bw, "};\n")
+	}
+	return bw.Flush()
+}
+
+// WriteGo writes the arrays as the byte array variables of a Go source file of the given package.
+// Nothing is written if the package or an array name is not a valid identifier.
+func WriteGo(w io.Writer, pkg string, arrays ...Array) error {
+	if !isIdentifier(pkg) {
+		return ErrIdentifier
+	}
+	if err := checkNames(arrays); err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "// Code generated by colorquant. DO NOT EDIT.\n\npackage %s\n", pkg)
+	for _, a := range arrays {
+		fmt.Fprintf(bw, "\nvar %s = [%d]byte{\n", a.Name, len(a.Data))
+		writeBytes(bw, a.Data)
+		fmt.Fprint(bw, "}\n")
+	}
+	return bw.Flush()
+}
+
+// writeBytes writes the data as hexadecimal literals, 12 per line.
+func writeBytes(w io.Writer, data []byte) {
+	for i, v := range data {
+		switch {
+		case i%12 == 0:
+			fmt.Fprint(w, "\t")
+		default:
+			fmt.Fprint(w, " ")
+		}
+		fmt.Fprintf(w, "0x%02x,", v)
+		if i%12 == 11 || i == len(data)-1 {
+			fmt.Fprint(w, "\n")
+		}
+	}
+}
+
+// checkNames returns ErrIdentifier if an array name is not a valid identifier.
+func checkNames(arrays []Array) error {
+	for _, a := range arrays {
+		if !isIdentifier(a.Name) {
+			return ErrIdentifier
+		}
+	}
+	return nil
+}
+
+// keywords holds the reserved words of C and Go, which can't be used as identifiers.
+var keywords = map[string]bool{
+	// C
+	"auto": true, "break": true, "case": true, "char": true, "const": true, "continue": true,
+	"default": true, "do": true, "double": true, "else": true, "enum": true, "extern": true,
+	"float": true, "for": true, "goto": true, "if": true, "inline": true, "int": true,
+	"long": true, "register": true, "restrict": true, "return": true, "short": true,
+	"signed": true, "sizeof": true, "static": true, "struct": true, "switch": true,
+	"typedef": true, "union": true, "unsigned": true, "void": true, "volatile": true, "while": true,
+	"_Alignas": true, "_Alignof": true, "_Atomic": true, "_Bool": true, "_Complex": true,
+	"_Generic": true, "_Imaginary": true, "_Noreturn": true, "_Static_assert": true, "_Thread_local": true,
+	// Go
+	"chan": true, "defer": true, "fallthrough": true, "func": true, "go": true, "import": true,
+	"interface": true, "map": true, "package": true, "range": true, "select": true, "type": true, "var": true,
+}
+
+// isIdentifier reports whether the name is a valid C and Go identifier, and not a keyword of either language.
+// The blank identifier is rejected as well.
+func isIdentifier(name string) bool {
+	if name == "" || name == "_" || keywords[name] {
+		return false
+	}
+	for i, r := range name {
+		if r > unicode.MaxASCII || !(r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return true
+}
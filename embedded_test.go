@@ -0,0 +1,107 @@
+package colorquant
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestEncodePixels(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{0xff, 0, 0, 0xff})
+	img.Set(1, 0, color.RGBA{0, 0xff, 0xff, 0xff})
+	tests := []struct {
+		format PixelFormat
+		order  binary.ByteOrder
+		want   []byte
+	}{
+		{RGB565, binary.BigEndian, []byte{0xf8, 0x00, 0x07, 0xff}},
+		{RGB565, binary.LittleEndian, []byte{0x00, 0xf8, 0xff, 0x07}},
+		{RGB555, binary.BigEndian, []byte{0x7c, 0x00, 0x03, 0xff}},
+		{RGB332, binary.BigEndian, []byte{0xe0, 0x1f}},
+	}
+	for _, tt := range tests {
+		if got := EncodePixels(img, tt.format, tt.order); !bytes.Equal(got, tt.want) {
+			t.Errorf("Format %d: expected %x, got %x", tt.format, tt.want, got)
+		}
+	}
+}
+
+func TestPixelFormat_Posterize(t *testing.T) {
+	// The colors of the posterizer are encoded exactly, every level to a different value.
+	for _, f := range []PixelFormat{RGB565, RGB555, RGB332} {
+		p := f.Posterize().Palette()
+		seen := make(map[uint16]bool)
+		for _, c := range p {
+			seen[f.pack(c)] = true
+		}
+		if len(seen) != len(p) {
+			t.Errorf("Format %d: expected %d distinct values, got %d", f, len(p), len(seen))
+		}
+	}
+}
+
+func TestPackIndices(t *testing.T) {
+	img := image.NewPaletted(image.Rect(0, 0, 5, 2), make(color.Palette, 4))
+	copy(img.Pix, []uint8{1, 0, 1, 1, 0, 0, 1, 0, 0, 1})
+	got, err := PackIndices(img, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xb0, 0x48}; !bytes.Equal(got, want) {
+		t.Errorf("Expected %x, got %x", want, got)
+	}
+
+	img.Pix[0] = 3
+	got, _ = PackIndices(img, 2)
+	if want := []byte{0xc5, 0x00, 0x10, 0x40}; !bytes.Equal(got, want) {
+		t.Errorf("Expected %x, got %x", want, got)
+	}
+	if _, err := PackIndices(img, 1); err != ErrTooManyColors {
+		t.Errorf("Expected ErrTooManyColors, got %v", err)
+	}
+	if _, err := PackIndices(img, 3); err != ErrBitDepth {
+		t.Errorf("Expected ErrBitDepth, got %v", err)
+	}
+}
+
+func TestWriteSource(t *testing.T) {
+	arrays := []Array{{"image_pixels", []byte{1, 2, 0xff}}, {"palette", make([]byte, 13)}}
+	var c bytes.Buffer
+	if err := WriteC(&c, arrays...); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(c.String(), "static const uint8_t image_pixels[3] = {\n\t0x01, 0x02, 0xff,\n};") {
+		t.Errorf("Unexpected C header:\n%s", c.String())
+	}
+	var g bytes.Buffer
+	if err := WriteGo(&g, "assets", arrays...); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(g.String(), "package assets") || strings.Count(g.String(), "\n\t0x00") != 2 {
+		t.Errorf("Unexpected Go source:\n%s", g.String())
+	}
+	for _, name := range []string{"1st", "var", "static", "_"} {
+		if err := WriteGo(&g, "assets", Array{name, nil}); err != ErrIdentifier {
+			t.Errorf("Expected ErrIdentifier for %q, got %v", name, err)
+		}
+	}
+	if err := WriteGo(&g, "var", arrays...); err != ErrIdentifier {
+		t.Errorf("Expected ErrIdentifier for the package name, got %v", err)
+	}
+	// Nothing is written if any of the names is invalid.
+	var empty bytes.Buffer
+	if err := WriteC(&empty, arrays[0], Array{"int", nil}); err != ErrIdentifier || empty.Len() > 0 {
+		t.Errorf("Expected ErrIdentifier and no output, got %v and %q", err, empty.String())
+	}
+	// C has no zero-length arrays, Go has.
+	if err := WriteC(&empty, arrays[0], Array{"none", nil}); err != ErrEmptyArray || empty.Len() > 0 {
+		t.Errorf("Expected ErrEmptyArray and no output, got %v and %q", err, empty.String())
+	}
+	if err := WriteGo(&empty, "assets", Array{"none", nil}); err != nil || !strings.Contains(empty.String(), "var none = [0]byte{\n}") {
+		t.Errorf("Expected an empty Go array, got %v and %q", err, empty.String())
+	}
+}
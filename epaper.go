@@ -0,0 +1,124 @@
+package colorquant
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"sort"
+	"strings"
+)
+
+// EPaper is a preset for an e-paper panel. The pixels are matched against the colors the panel
+// really displays, so that the dithering compensates for the gray paper white and the dull inks,
+// then the matched colors are replaced by the idealized colors the panel driver expects.
+type EPaper struct {
+	// Measured holds the colors as displayed by the panel, used for matching.
+	Measured color.Palette
+	// Output holds the colors sent to the panel, in the same order as Measured.
+	Output color.Palette
+	// Dither is the recommended dithering method of the panel.
+	Dither Quantizer
+}
+
+// ePaperPresets is the catalogue of the e-paper presets. The measured colors are typical
+// values, the exact ones depend on the panel, the lighting and the temperature.
+var ePaperPresets = map[string]func() EPaper{
+	"gray2": func() EPaper {
+		return EPaper{grayRamp(2, 0x22, 0xe6), grayRamp(2, 0, 0xff), Atkinson.clone()}
+	},
+	"gray4": func() EPaper {
+		return EPaper{grayRamp(4, 0x22, 0xe6), grayRamp(4, 0, 0xff), FloydSteinberg.clone()}
+	},
+	"gray16": func() EPaper {
+		return EPaper{grayRamp(16, 0x22, 0xe6), grayRamp(16, 0, 0xff), FloydSteinberg.clone()}
+	},
+	// Black, white and red panels.
+	"bwr": func() EPaper {
+		return EPaper{
+			color.Palette{
+				color.RGBA{0x1e, 0x1e, 0x1e, 0xff},
+				color.RGBA{0xe6, 0xe6, 0xe0, 0xff},
+				color.RGBA{0xb4, 0x28, 0x28, 0xff},
+			},
+			color.Palette{
+				color.RGBA{0, 0, 0, 0xff},
+				color.RGBA{0xff, 0xff, 0xff, 0xff},
+				color.RGBA{0xff, 0, 0, 0xff},
+			},
+			FloydSteinberg.clone(),
+		}
+	},
+	// 7 color ACeP (Advanced Color ePaper) panels.
+	"acep7": func() EPaper {
+		return EPaper{
+			color.Palette{
+				color.RGBA{0x39, 0x30, 0x39, 0xff}, // black
+				color.RGBA{0xff, 0xff, 0xff, 0xff}, // white
+				color.RGBA{0x3a, 0x5b, 0x46, 0xff}, // green
+				color.RGBA{0x3d, 0x3b, 0x5e, 0xff}, // blue
+				color.RGBA{0x9c, 0x48, 0x4b, 0xff}, // red
+				color.RGBA{0xd0, 0xbe, 0x47, 0xff}, // yellow
+				color.RGBA{0xb1, 0x6a, 0x49, 0xff}, // orange
+			},
+			color.Palette{
+				color.RGBA{0, 0, 0, 0xff},
+				color.RGBA{0xff, 0xff, 0xff, 0xff},
+				color.RGBA{0, 0xff, 0, 0xff},
+				color.RGBA{0, 0, 0xff, 0xff},
+				color.RGBA{0xff, 0, 0, 0xff},
+				color.RGBA{0xff, 0xff, 0, 0xff},
+				color.RGBA{0xff, 0x80, 0, 0xff},
+			},
+			FloydSteinberg.clone(),
+		}
+	},
+}
+
+// grayRamp returns n evenly spaced gray levels from black to white.
+func grayRamp(n int, black, white uint8) color.Palette {
+	p := make(color.Palette, n)
+	for i := range p {
+		p[i] = color.Gray{Y: uint8(int(black) + i*(int(white)-int(black))/(n-1))}
+	}
+	return p
+}
+
+// EPaperPreset returns the e-paper preset with the given name: "gray2", "gray4" and "gray16" for
+// grayscale panels, "bwr" for black, white and red panels, and "acep7" for 7 color ACeP panels.
+// The name is case insensitive. The preset is a new copy, so it can be adjusted to the panel at hand.
+func EPaperPreset(name string) (EPaper, bool) {
+	preset, ok := ePaperPresets[strings.ToLower(name)]
+	if !ok {
+		return EPaper{}, false
+	}
+	return preset(), true
+}
+
+// EPaperPresets returns the names of the e-paper presets in alphabetical order.
+func EPaperPresets() []string {
+	names := make([]string, 0, len(ePaperPresets))
+	for name := range ePaperPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ErrOutputColors is returned when the output colors of an e-paper preset don't match the measured colors one to one.
+var ErrOutputColors = errors.New("colorquant: the output colors should match the measured colors one to one")
+
+// Quantize dithers the image onto the measured colors of the panel, and returns the result with the
+// output colors. A nil Dither maps the pixels without dithering. It returns ErrOutputColors if the
+// number of output colors differs from the number of measured colors.
+func (e EPaper) Quantize(src image.Image) (*image.Paletted, error) {
+	if len(e.Output) != len(e.Measured) {
+		return nil, ErrOutputColors
+	}
+	q := e.Dither
+	if q == nil {
+		q = NoDither
+	}
+	dst := Remap(src, e.Measured, q, true)
+	dst.Palette = append(color.Palette(nil), e.Output...)
+	return dst, nil
+}
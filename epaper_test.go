@@ -0,0 +1,87 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEPaperPreset(t *testing.T) {
+	sizes := map[string]int{"gray2": 2, "gray4": 4, "gray16": 16, "bwr": 3, "acep7": 7}
+	for name, n := range sizes {
+		e, ok := EPaperPreset(name)
+		if !ok {
+			t.Errorf("The preset %q should be available", name)
+			continue
+		}
+		if len(e.Measured) != n || len(e.Output) != n {
+			t.Errorf("Expected %d colors in the preset %q, got %d measured and %d output colors", n, name, len(e.Measured), len(e.Output))
+		}
+		if e.Dither == nil {
+			t.Errorf("The preset %q should have a default dither", name)
+		}
+	}
+	if len(EPaperPresets()) != len(sizes) {
+		t.Errorf("Expected %d presets, got %v", len(sizes), EPaperPresets())
+	}
+	if _, ok := EPaperPreset("unknown"); ok {
+		t.Error("Expected an unknown preset to be missing")
+	}
+	// Adjusting the filter of a preset leaves the shared kernels untouched.
+	e, _ := EPaperPreset("gray4")
+	e.Dither.(Dither).Filter[0][2] = 0
+	if FloydSteinberg.Filter[0][2] != 7.0/16 {
+		t.Error("The preset should have its own copy of the filter")
+	}
+}
+
+func TestEPaper_Quantize(t *testing.T) {
+	e, _ := EPaperPreset("ACeP7")
+	// The color the panel displays as red is sent to the panel as pure red.
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, e.Measured[4])
+		}
+	}
+	res, err := e.Quantize(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range res.Pix {
+		if !sameColor(res.Palette[res.Pix[i]], color.RGBA{0xff, 0, 0, 0xff}) {
+			t.Fatalf("Expected pure red output, got %v", res.Palette[res.Pix[i]])
+		}
+	}
+	// The preset palettes are not modified.
+	if !sameColor(e.Measured[4], color.RGBA{0x9c, 0x48, 0x4b, 0xff}) {
+		t.Error("The measured palette should not be modified")
+	}
+	// An output palette not matching the measured colors is a configuration error.
+	e.Output = e.Output[:3]
+	if _, err := e.Quantize(img); err != ErrOutputColors {
+		t.Errorf("Expected %v, got %v", ErrOutputColors, err)
+	}
+}
+
+func TestEPaper_Gray(t *testing.T) {
+	// A mid gray between the measured black and white is dithered to about half white pixels.
+	e, _ := EPaperPreset("gray2")
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = 0x84
+	}
+	res, err := e.Quantize(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	white := 0
+	for _, i := range res.Pix {
+		if sameColor(res.Palette[i], color.White) {
+			white++
+		}
+	}
+	if white < 32*32*2/5 || white > 32*32*3/5 {
+		t.Errorf("Expected about half of the pixels to be white, got %d of %d", white, 32*32)
+	}
+}
@@ -0,0 +1,65 @@
+package colorquant
+
+// fixedWeights compares the colors on all channels, so that a transparent key
+// matches only the transparent pixels.
+var fixedWeights = rgbaWeights
+
+// assignFixed moves the pixels of the initial cluster which are within the tolerance
+// of a fixed color to that color. If all is true, every pixel is assigned to its
+// closest fixed color and no clusters remain.
+func (qz *Quant) assignFixed(all bool) {
+	fixed := paletteValues(qz.Fixed)
+	tree := newKDTree(fixed, fixedWeights)
+	tol := qz.FixedTolerance * 257
+	qz.fx = make([][]point, len(fixed))
+
+	c := &qz.cs[0]
+	kept := c.px[:0]
+	for _, p := range c.px {
+		r, g, b, a := qz.img.At(p.x, p.y).RGBA()
+		idx := tree.nearest(int32(r), int32(g), int32(b), int32(a))
+		if all || rgbaDist(fixed[idx], int32(r), int32(g), int32(b), int32(a)) <= tol*tol {
+			qz.fx[idx] = append(qz.fx[idx], p)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	c.px = kept
+	if len(c.px) == 0 {
+		qz.cs = qz.cs[:0]
+	}
+}
+
+// lockFixed moves the clustered pixels which are closer to a fixed color than
+// to the average color of their cluster. Clusters left empty are removed.
+func (qz *Quant) lockFixed() {
+	fixed := paletteValues(qz.Fixed)
+	tree := newKDTree(fixed, fixedWeights)
+
+	cs := qz.cs[:0]
+	for _, c := range qz.cs {
+		avg := qz.average(c.px)
+		mean := [4]int32{int32(avg.R), int32(avg.G), int32(avg.B), int32(avg.A)}
+		kept := c.px[:0]
+		for _, p := range c.px {
+			r, g, b, a := qz.img.At(p.x, p.y).RGBA()
+			idx := tree.nearest(int32(r), int32(g), int32(b), int32(a))
+			if rgbaDist(fixed[idx], int32(r), int32(g), int32(b), int32(a)) < rgbaDist(mean, int32(r), int32(g), int32(b), int32(a)) {
+				qz.fx[idx] = append(qz.fx[idx], p)
+				continue
+			}
+			kept = append(kept, p)
+		}
+		if len(kept) > 0 {
+			c.px = kept
+			cs = append(cs, c)
+		}
+	}
+	qz.cs = cs
+}
+
+// rgbaDist returns the squared Euclidean distance of two colors in R,G,B,A space.
+func rgbaDist(c [4]int32, r, g, b, a int32) float64 {
+	dr, dg, db, da := float64(c[0]-r), float64(c[1]-g), float64(c[2]-b), float64(c[3]-a)
+	return dr*dr + dg*dg + db*db + da*da
+}
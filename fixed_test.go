@@ -0,0 +1,55 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestQuant_Fixed(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 0xff
+	}
+	// A few pixels of a brand color and a transparent key.
+	brand := color.RGBA{0x12, 0x34, 0x56, 0xff}
+	img.Set(0, 0, brand)
+	img.Set(1, 0, brand)
+	img.Set(2, 0, color.Transparent)
+
+	q := Quant{Fixed: color.Palette{brand, color.Transparent, color.White}}
+	p := q.Quantize(img, 8).(*image.Paletted)
+
+	if len(p.Palette) != 8 {
+		t.Fatalf("Expected a palette of 8 colors, got %d", len(p.Palette))
+	}
+	for i, c := range q.Fixed {
+		if p.Palette[i] != c {
+			t.Errorf("The fixed color %v should occupy the palette slot %d, got %v", c, i, p.Palette[i])
+		}
+	}
+	if p.ColorIndexAt(0, 0) != 0 || p.ColorIndexAt(1, 0) != 0 {
+		t.Error("The brand colored pixels should be mapped to the brand color")
+	}
+	if p.ColorIndexAt(2, 0) != 1 {
+		t.Error("The transparent pixels should be mapped to the transparent key")
+	}
+}
+
+func TestQuant_FixedOnly(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 16)
+	}
+	q := Quant{Fixed: color.Palette{color.Black, color.White}}
+	p := q.Quantize(img, 2).(*image.Paletted)
+
+	if len(p.Palette) != 2 {
+		t.Fatalf("Only the fixed colors should be used, got %d colors", len(p.Palette))
+	}
+	if p.ColorIndexAt(0, 0) != 0 || p.ColorIndexAt(3, 3) != 1 {
+		t.Error("The pixels should be mapped to their closest fixed color")
+	}
+}
@@ -0,0 +1,114 @@
+package colorquant
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+)
+
+// GIFOptions holds the options of the animated GIF quantization.
+type GIFOptions struct {
+	// NumColors is the number of colors of each palette, including the slot reserved
+	// for the transparent color. Defaults to 256.
+	NumColors int
+	// Local generates a local palette for each frame instead of a single global palette.
+	Local bool
+	// Ditherer maps the frames onto the palettes. Defaults to NoDither.
+	Ditherer Quantizer
+	// Tolerance is the maximum difference per channel, in 8 bit units, between a pixel and its
+	// value at the time it was last drawn, for the pixel to be considered unchanged.
+	Tolerance uint8
+	// Delay is the delay of each frame in 100ths of a second.
+	Delay int
+	// LoopCount controls the number of times the animation is played, as in gif.GIF.
+	LoopCount int
+}
+
+var (
+	// ErrNoFrames is returned when quantizing an animation without frames.
+	ErrNoFrames = errors.New("colorquant: no frames to quantize")
+	// ErrFrameSize is returned when the frames of an animation have different sizes.
+	ErrFrameSize = errors.New("colorquant: frames should have the same size")
+	// ErrGIFColors is returned when the number of colors doesn't fit in a GIF palette.
+	ErrGIFColors = errors.New("colorquant: a GIF palette can hold between 2 and 256 colors")
+)
+
+// QuantizeGIF quantizes a sequence of frames into an animated GIF.
+//
+// The pixels which didn't change since they were last drawn are encoded as transparent,
+// so that the previous frame remains visible through them. This keeps the frames small,
+// and freezes the dithering pattern of the static regions, which removes the flickering
+// of the frame by frame error diffusion.
+func QuantizeGIF(frames []image.Image, opts GIFOptions) (*gif.GIF, error) {
+	if len(frames) == 0 {
+		return nil, ErrNoFrames
+	}
+	nq := opts.NumColors
+	if nq == 0 {
+		nq = 256
+	}
+	if nq < 2 || nq > 256 {
+		return nil, ErrGIFColors
+	}
+	ditherer := opts.Ditherer
+	if ditherer == nil {
+		ditherer = NoDither
+	}
+	b := frames[0].Bounds()
+	for _, f := range frames {
+		if f.Bounds().Dx() != b.Dx() || f.Bounds().Dy() != b.Dy() {
+			return nil, ErrFrameSize
+		}
+	}
+	// One palette slot is reserved for the transparent color.
+	var global color.Palette
+	if !opts.Local {
+		global = Quant{}.SharedPalette(frames, nil, nq-1)
+	}
+
+	anim := &gif.GIF{LoopCount: opts.LoopCount}
+	// ref holds the source color of each pixel at the time it was last drawn.
+	ref := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	tol := int(opts.Tolerance)
+
+	for n, f := range frames {
+		pal := global
+		if opts.Local {
+			pal = Quant{}.Quantize(f, nq-1).(*image.Paletted).Palette
+		}
+		// Map the frame onto the opaque colors, then extend the palette with the transparent one.
+		img := Remap(f, pal, ditherer, true)
+		img.Rect = image.Rect(0, 0, b.Dx(), b.Dy())
+		img.Palette = append(pal[:len(pal):len(pal)], color.Transparent)
+		transparent := uint8(len(pal))
+
+		fb := f.Bounds()
+		for y := 0; y < b.Dy(); y++ {
+			for x := 0; x < b.Dx(); x++ {
+				c := color.RGBAModel.Convert(f.At(fb.Min.X+x, fb.Min.Y+y)).(color.RGBA)
+				i := ref.PixOffset(x, y)
+				if n > 0 && within(ref.Pix[i:i+4], c, tol) {
+					img.SetColorIndex(x, y, transparent)
+					continue
+				}
+				ref.Pix[i], ref.Pix[i+1], ref.Pix[i+2], ref.Pix[i+3] = c.R, c.G, c.B, c.A
+			}
+		}
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, opts.Delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+	return anim, nil
+}
+
+// within checks if every channel of the color differs from the reference by at most tol.
+func within(ref []uint8, c color.RGBA, tol int) bool {
+	for i, v := range [4]uint8{c.R, c.G, c.B, c.A} {
+		d := int(v) - int(ref[i])
+		if d < -tol || d > tol {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package colorquant
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+func TestQuantizeGIF(t *testing.T) {
+	var frames []image.Image
+	for i := 0; i < 3; i++ {
+		f := solid(8, 8, color.RGBA{0x20, 0x80, 0xc0, 0xff})
+		// A moving red square on a static background.
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 2; x++ {
+				f.Set(i*2+x, y, color.RGBA{0xff, 0, 0, 0xff})
+			}
+		}
+		frames = append(frames, f)
+	}
+	anim, err := QuantizeGIF(frames, GIFOptions{NumColors: 16, Delay: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 3 || len(anim.Delay) != 3 {
+		t.Fatalf("Expected 3 frames, got %d", len(anim.Image))
+	}
+	// The static background should be transparent on the following frames.
+	f := anim.Image[1]
+	if _, _, _, a := f.At(7, 7).RGBA(); a != 0 {
+		t.Error("Unchanged pixels should be transparent")
+	}
+	if _, _, _, a := f.At(2, 0).RGBA(); a == 0 {
+		t.Error("Changed pixels should be drawn")
+	}
+	if _, _, _, a := f.At(0, 0).RGBA(); a == 0 {
+		t.Error("Pixels uncovered by the moving square should be drawn")
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("The animation should be encodable: %v", err)
+	}
+}
+
+func TestQuantizeGIF_Errors(t *testing.T) {
+	if _, err := QuantizeGIF(nil, GIFOptions{}); err != ErrNoFrames {
+		t.Errorf("Expected %v, got %v", ErrNoFrames, err)
+	}
+	frames := []image.Image{solid(2, 2, color.Black), solid(3, 2, color.Black)}
+	if _, err := QuantizeGIF(frames, GIFOptions{Local: true}); err != ErrFrameSize {
+		t.Errorf("Expected %v, got %v", ErrFrameSize, err)
+	}
+	if _, err := QuantizeGIF(frames[:1], GIFOptions{NumColors: 512}); err != ErrGIFColors {
+		t.Errorf("Expected %v, got %v", ErrGIFColors, err)
+	}
+}
@@ -0,0 +1,178 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// GrayQuant quantizes the luminance of an image to a few gray levels. The levels are found by
+// the optimal partition of the luminance histogram, which minimizes the within-class variance:
+// for 2 levels this is Otsu's threshold, for more levels the multi-level Otsu (Jenks natural breaks)
+// partition. Each level is the mean luminance of its class, so the average luminance is preserved.
+// Unlike the median cut, it never produces tinted palette entries.
+type GrayQuant struct {
+	// Levels is the number of gray levels, between 2 and 256. Defaults to 2.
+	Levels int
+	// Dither is the optional error diffusion applied when mapping the pixels to the levels.
+	// The zero value maps every pixel to the nearest level.
+	Dither Dither
+}
+
+// Quantize returns the image mapped to the gray levels, with a palette of the gray ramp.
+func (gq GrayQuant) Quantize(img image.Image) *image.Paletted {
+	levels := GrayLevels(img, gq.levels())
+	p := make(color.Palette, len(levels))
+	for i, l := range levels {
+		p[i] = color.Gray{Y: l}
+	}
+	dst := image.NewPaletted(img.Bounds(), p)
+	pix, stride := dst.Pix, dst.Stride
+	gq.mapLevels(img, levels, func(x, y, i int) {
+		pix[y*stride+x] = uint8(i)
+	})
+	return dst
+}
+
+// QuantizeGray returns the image mapped to the gray levels as a grayscale image.
+func (gq GrayQuant) QuantizeGray(img image.Image) *image.Gray {
+	levels := GrayLevels(img, gq.levels())
+	dst := image.NewGray(img.Bounds())
+	pix, stride := dst.Pix, dst.Stride
+	gq.mapLevels(img, levels, func(x, y, i int) {
+		pix[y*stride+x] = levels[i]
+	})
+	return dst
+}
+
+func (gq GrayQuant) levels() int {
+	switch {
+	case gq.Levels < 2:
+		return 2
+	case gq.Levels > 256:
+		return 256
+	}
+	return gq.Levels
+}
+
+// mapLevels maps the luminance of every pixel to the nearest level, diffusing the error if dithering is set.
+// The set function receives the pixel coordinates relative to the image origin and the index of the level.
+func (gq GrayQuant) mapLevels(img image.Image, levels []uint8, set func(x, y, i int)) {
+	if len(levels) == 0 {
+		return
+	}
+	// Index of the nearest level of each 8 bit luminance value.
+	var nearest [256]int
+	for v := range nearest {
+		for i, l := range levels {
+			if absInt(int(l)-v) < absInt(int(levels[nearest[v]])-v) {
+				nearest[v] = i
+			}
+		}
+	}
+	gq.Dither.diffuse(grayLuma{img}, true, func(x, y int, r, g, b, a int32) (int32, int32, int32) {
+		i := nearest[r>>8]
+		set(x, y, i)
+		v := int32(levels[i]) * 0x101
+		return v, v, v
+	})
+}
+
+// grayLuma is an image which converts the source pixels to their luminance.
+type grayLuma struct {
+	image.Image
+}
+
+func (g grayLuma) At(x, y int) color.Color {
+	r, gr, b, _ := g.Image.At(x, y).RGBA()
+	return color.Gray16{Y: uint16((19595*r + 38470*gr + 7471*b + 1<<15) >> 16)}
+}
+
+// GrayLevels returns at most n gray levels in increasing order, which partition the luminance
+// histogram of the image with the smallest within-class variance. If the image has no more than n
+// distinct luminance values, these are returned.
+func GrayLevels(img image.Image, n int) []uint8 {
+	var hist [256]float64
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			hist[(19595*r+38470*g+7471*bl+1<<15)>>24]++
+		}
+	}
+	return partition(hist[:], n)
+}
+
+// partition splits the populated bins of the histogram into at most n classes of consecutive
+// values with dynamic programming, minimizing the sum of squared deviations from the class means.
+// It returns the rounded class means.
+func partition(hist []float64, n int) []uint8 {
+	// Keep only the populated bins.
+	var vals []int
+	for v, c := range hist {
+		if c > 0 {
+			vals = append(vals, v)
+		}
+	}
+	if len(vals) <= n {
+		levels := make([]uint8, len(vals))
+		for i, v := range vals {
+			levels[i] = uint8(v)
+		}
+		return levels
+	}
+	// Prefix sums of the weights, the weighted values and the weighted squares.
+	m := len(vals)
+	w, s, ss := make([]float64, m+1), make([]float64, m+1), make([]float64, m+1)
+	for i, v := range vals {
+		c, fv := hist[v], float64(v)
+		w[i+1] = w[i] + c
+		s[i+1] = s[i] + c*fv
+		ss[i+1] = ss[i] + c*fv*fv
+	}
+	// cost returns the sum of squared deviations of the bins i..j-1.
+	cost := func(i, j int) float64 {
+		sw, sv := w[j]-w[i], s[j]-s[i]
+		return ss[j] - ss[i] - sv*sv/sw
+	}
+	// dp[k][j] is the smallest cost of splitting the first j bins into k+1 classes,
+	// and from[k][j] is the start of the last class.
+	dp := make([][]float64, n)
+	from := make([][]int, n)
+	for k := range dp {
+		dp[k] = make([]float64, m+1)
+		from[k] = make([]int, m+1)
+		for j := range dp[k] {
+			dp[k][j] = math.Inf(1)
+		}
+	}
+	for j := 1; j <= m; j++ {
+		dp[0][j] = cost(0, j)
+	}
+	for k := 1; k < n; k++ {
+		for j := k + 1; j <= m; j++ {
+			for i := k; i < j; i++ {
+				if c := dp[k-1][i] + cost(i, j); c < dp[k][j] {
+					dp[k][j], from[k][j] = c, i
+				}
+			}
+		}
+	}
+	levels := make([]uint8, n)
+	for k, j := n-1, m; k >= 0; k-- {
+		i := 0
+		if k > 0 {
+			i = from[k][j]
+		}
+		levels[k] = uint8((s[j]-s[i])/(w[j]-w[i]) + 0.5)
+		j = i
+	}
+	return levels
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,133 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestPartition_Otsu(t *testing.T) {
+	// Two clearly separated modes.
+	hist := make([]float64, 256)
+	hist[10], hist[20], hist[200], hist[210] = 5, 5, 3, 1
+	levels := partition(hist, 2)
+	if len(levels) != 2 || levels[0] != 15 || levels[1] != 203 {
+		t.Errorf("Expected the levels [15 203], got %v", levels)
+	}
+}
+
+func TestPartition_Optimal(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	hist := make([]float64, 256)
+	var vals []int
+	for len(vals) < 12 {
+		v := rnd.Intn(256)
+		if hist[v] == 0 {
+			vals = append(vals, v)
+		}
+		hist[v] += float64(rnd.Intn(10) + 1)
+	}
+	sse := func(levels []uint8) float64 {
+		var sum float64
+		for v, c := range hist {
+			d := math.Inf(1)
+			for _, l := range levels {
+				d = math.Min(d, math.Abs(float64(v)-float64(l)))
+			}
+			sum += c * d * d
+		}
+		return sum
+	}
+	// Compare with every split of the populated values into three consecutive classes.
+	sorted := make([]int, 0, len(vals))
+	for v := range hist {
+		if hist[v] > 0 {
+			sorted = append(sorted, v)
+		}
+	}
+	mean := func(vs []int) uint8 {
+		var s, w float64
+		for _, v := range vs {
+			s += hist[v] * float64(v)
+			w += hist[v]
+		}
+		return uint8(s/w + 0.5)
+	}
+	best := math.Inf(1)
+	for i := 1; i < len(sorted)-1; i++ {
+		for j := i + 1; j < len(sorted); j++ {
+			best = math.Min(best, sse([]uint8{mean(sorted[:i]), mean(sorted[i:j]), mean(sorted[j:])}))
+		}
+	}
+	if got := sse(partition(hist, 3)); got > best+1e-6 {
+		t.Errorf("Expected the optimal partition with error %f, got %f", best, got)
+	}
+}
+
+func TestGrayLevels_FewValues(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 3, 1))
+	img.Pix[0], img.Pix[1], img.Pix[2] = 0, 100, 100
+	levels := GrayLevels(img, 4)
+	if len(levels) != 2 || levels[0] != 0 || levels[1] != 100 {
+		t.Errorf("Expected the levels [0 100], got %v", levels)
+	}
+}
+
+func TestGrayQuant(t *testing.T) {
+	// A colorful gradient.
+	img := image.NewRGBA(image.Rect(0, 0, 64, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(255 - x*4), uint8(y * 16), 0xff})
+		}
+	}
+	p := GrayQuant{Levels: 4}.Quantize(img)
+	if len(p.Palette) != 4 {
+		t.Errorf("Expected 4 gray levels, got %d", len(p.Palette))
+	}
+	for _, c := range p.Palette {
+		if r, g, b, _ := c.RGBA(); r != g || g != b {
+			t.Errorf("The palette should hold only gray colors, got %v", c)
+		}
+	}
+
+	g := GrayQuant{Levels: 4}.QuantizeGray(img)
+	for i := range g.Pix {
+		if g.Pix[i] != p.Palette[p.Pix[i]].(color.Gray).Y {
+			t.Fatal("The gray and the paletted results should match")
+		}
+	}
+}
+
+func TestGrayQuant_Dither(t *testing.T) {
+	// A horizontal gray ramp dithered to black and white preserves the average luminance of the columns.
+	img := image.NewGray(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Pix[y*img.Stride+x] = uint8(x * 4)
+		}
+	}
+	fs := Dither{Filter: [][]float32{
+		{0, 0, 7.0 / 16},
+		{3.0 / 16, 5.0 / 16, 1.0 / 16},
+	}}
+	plain := GrayQuant{}.QuantizeGray(img)
+	dithered := GrayQuant{Dither: fs}.QuantizeGray(img)
+	colErr := func(res *image.Gray) float64 {
+		var sum float64
+		for x := 0; x < 64; x++ {
+			var src, dst float64
+			for y := 0; y < 64; y++ {
+				src += float64(img.Pix[y*img.Stride+x])
+				dst += float64(res.Pix[y*res.Stride+x])
+			}
+			sum += math.Abs(src-dst) / 64
+		}
+		return sum / 64
+	}
+	if colErr(dithered) >= colErr(plain) {
+		t.Errorf("Dithering should preserve the local luminance better: %f >= %f", colErr(dithered), colErr(plain))
+	}
+}
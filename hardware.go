@@ -0,0 +1,105 @@
+package colorquant
+
+import (
+	"image/color"
+	"sort"
+	"strings"
+)
+
+// cga is the 16 color RGBI palette of the IBM CGA, with the dark yellow turned to brown.
+// It's also the default palette of the EGA.
+var cga = []uint32{
+	0x000000, 0x0000aa, 0x00aa00, 0x00aaaa, 0xaa0000, 0xaa00aa, 0xaa5500, 0xaaaaaa,
+	0x555555, 0x5555ff, 0x55ff55, 0x55ffff, 0xff5555, 0xff55ff, 0xffff55, 0xffffff,
+}
+
+// hardwarePalettes is the catalogue of the classic hardware palettes, in 0xRRGGBB format.
+// The entries keep the order of the hardware color indices, including the duplicates.
+var hardwarePalettes = map[string][]uint32{
+	"cga": cga,
+	// The 4 color graphics modes of the CGA, with black background, in low and high intensity.
+	"cga0":      {0x000000, 0x00aa00, 0xaa0000, 0xaa5500},
+	"cga0-high": {0x000000, 0x55ff55, 0xff5555, 0xffff55},
+	"cga1":      {0x000000, 0x00aaaa, 0xaa00aa, 0xaaaaaa},
+	"cga1-high": {0x000000, 0x55ffff, 0xff55ff, 0xffffff},
+	"cga5":      {0x000000, 0x00aaaa, 0xaa0000, 0xaaaaaa},
+	"cga5-high": {0x000000, 0x55ffff, 0xff5555, 0xffffff},
+	// The default EGA palette, and all the 64 colors of the EGA.
+	"ega":   cga,
+	"ega64": ega64(),
+	// The Commodore 64 palette measured by Pepto.
+	"c64": {
+		0x000000, 0xffffff, 0x68372b, 0x70a4b2, 0x6f3d86, 0x588d43, 0x352879, 0xb8c76f,
+		0x6f4f25, 0x433900, 0x9a6759, 0x444444, 0x6c6c6c, 0x9ad284, 0x6c5eb5, 0x959595,
+	},
+	// The 64 colors of the NES 2C02 PPU.
+	"nes": {
+		0x7c7c7c, 0x0000fc, 0x0000bc, 0x4428bc, 0x940084, 0xa80020, 0xa81000, 0x881400,
+		0x503000, 0x007800, 0x006800, 0x005800, 0x004058, 0x000000, 0x000000, 0x000000,
+		0xbcbcbc, 0x0078f8, 0x0058f8, 0x6844fc, 0xd800cc, 0xe40058, 0xf83800, 0xe45c10,
+		0xac7c00, 0x00b800, 0x00a800, 0x00a844, 0x008888, 0x000000, 0x000000, 0x000000,
+		0xf8f8f8, 0x3cbcfc, 0x6888fc, 0x9878f8, 0xf878f8, 0xf85898, 0xf87858, 0xfca044,
+		0xf8b800, 0xb8f818, 0x58d854, 0x58f898, 0x00e8d8, 0x787878, 0x000000, 0x000000,
+		0xfcfcfc, 0xa4e4fc, 0xb8b8f8, 0xd8b8f8, 0xf8b8f8, 0xf8a4c0, 0xf0d0b0, 0xfce0a8,
+		0xf8d878, 0xd8f878, 0xb8f8b8, 0xb8f8d8, 0x00fcfc, 0xf8d8f8, 0x000000, 0x000000,
+	},
+	// The four green shades of the original Game Boy (DMG), from the lightest to the darkest.
+	"gameboy": {0x9bbc0f, 0x8bac0f, 0x306230, 0x0f380f},
+	// The 16 colors of the PICO-8 fantasy console.
+	"pico8": {
+		0x000000, 0x1d2b53, 0x7e2553, 0x008751, 0xab5236, 0x5f574f, 0xc2c3c7, 0xfff1e8,
+		0xff004d, 0xffa300, 0xffec27, 0x00e436, 0x29adff, 0x83769c, 0xff77a8, 0xffccaa,
+	},
+	// The ZX Spectrum colors in normal and bright intensity.
+	"zxspectrum": {
+		0x000000, 0x0000d7, 0xd70000, 0xd700d7, 0x00d700, 0x00d7d7, 0xd7d700, 0xd7d7d7,
+		0x000000, 0x0000ff, 0xff0000, 0xff00ff, 0x00ff00, 0x00ffff, 0xffff00, 0xffffff,
+	},
+	// The 16 low resolution colors of the Apple II.
+	"apple2": {
+		0x000000, 0xe31e60, 0x604ebd, 0xff44fd, 0x00a360, 0x9c9c9c, 0x14cffd, 0xd0c3ff,
+		0x607203, 0xff6a3c, 0x9c9c9c, 0xffa0d0, 0x14f53c, 0xd0dd8d, 0x72ffd0, 0xffffff,
+	},
+	// The default 4 color Workbench palettes of the Amiga OCS. The whole 12 bit
+	// color space of the OCS can be reproduced by PosterizeBits(4, 4, 4).
+	"amiga-wb1": {0x0055aa, 0xffffff, 0x000022, 0xff8800},
+	"amiga-wb2": {0xaaaaaa, 0x000000, 0xffffff, 0x6688bb},
+}
+
+// ega64 returns the 64 colors of the EGA. The bits of the color index are rgbRGB,
+// where the upper case bits add 0xaa and the lower case bits 0x55 to the channel.
+func ega64() []uint32 {
+	p := make([]uint32, 64)
+	for i := range p {
+		r := 0xaa*uint32(i>>2&1) + 0x55*uint32(i>>5&1)
+		g := 0xaa*uint32(i>>1&1) + 0x55*uint32(i>>4&1)
+		b := 0xaa*uint32(i&1) + 0x55*uint32(i>>3&1)
+		p[i] = r<<16 | g<<8 | b
+	}
+	return p
+}
+
+// HardwarePalette returns the built-in classic hardware palette with the given name, like
+// "cga", "ega64", "c64", "nes", "gameboy", "pico8", "zxspectrum", "apple2" or "amiga-wb1".
+// The name is case insensitive. The palette is a new copy, so it can be modified freely.
+func HardwarePalette(name string) (color.Palette, bool) {
+	vals, ok := hardwarePalettes[strings.ToLower(name)]
+	if !ok {
+		return nil, false
+	}
+	p := make(color.Palette, len(vals))
+	for i, v := range vals {
+		p[i] = color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}
+	}
+	return p, true
+}
+
+// HardwarePalettes returns the names of the built-in hardware palettes in alphabetical order.
+func HardwarePalettes() []string {
+	names := make([]string, 0, len(hardwarePalettes))
+	for name := range hardwarePalettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
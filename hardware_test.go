@@ -0,0 +1,56 @@
+package colorquant
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestHardwarePalette(t *testing.T) {
+	sizes := map[string]int{
+		"cga": 16, "cga0": 4, "cga1-high": 4, "ega": 16, "ega64": 64, "c64": 16, "nes": 64,
+		"gameboy": 4, "pico8": 16, "zxspectrum": 16, "apple2": 16, "amiga-wb1": 4, "amiga-wb2": 4,
+	}
+	for name, n := range sizes {
+		p, ok := HardwarePalette(name)
+		if !ok {
+			t.Errorf("The palette %q should be available", name)
+			continue
+		}
+		if len(p) != n {
+			t.Errorf("Expected %d colors in the palette %q, got %d", n, name, len(p))
+		}
+	}
+	if len(HardwarePalettes()) < len(sizes) {
+		t.Errorf("Expected at least %d palette names, got %v", len(sizes), HardwarePalettes())
+	}
+	if _, ok := HardwarePalette("unknown"); ok {
+		t.Error("Expected an unknown palette to be missing")
+	}
+}
+
+func TestHardwarePalette_Copy(t *testing.T) {
+	p, _ := HardwarePalette("PICO8")
+	want := color.RGBA{0xff, 0x00, 0x4d, 0xff}
+	if !sameColor(p[8], want) {
+		t.Errorf("Expected the color %v, got %v", want, p[8])
+	}
+	p[8] = color.Black
+	if q, _ := HardwarePalette("pico8"); !sameColor(q[8], want) {
+		t.Error("Modifying a returned palette should not change the catalogue")
+	}
+}
+
+func TestEGA64(t *testing.T) {
+	p, _ := HardwarePalette("ega64")
+	tests := map[int]color.RGBA{
+		0:  {0, 0, 0, 0xff},
+		20: {0xaa, 0x55, 0, 0xff}, // brown
+		57: {0x55, 0x55, 0xff, 0xff},
+		63: {0xff, 0xff, 0xff, 0xff},
+	}
+	for i, want := range tests {
+		if !sameColor(p[i], want) {
+			t.Errorf("Expected the EGA color %d to be %v, got %v", i, want, p[i])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package colorquant
+
+import (
+	"image/color"
+	"math"
+	"sort"
+)
+
+// kdTree is a static k-d tree built over the palette colors. It's used to find
+// the exact nearest palette color of a pixel without scanning the whole palette.
+type kdTree struct {
+	nodes []kdNode
+	root  int        // position of the root node, -1 if the tree is empty
+	scale [4]float64 // per-channel scale applied to the coordinates
+}
+
+type kdNode struct {
+	c           [4]float64 // scaled R,G,B,A coordinates of the palette color
+	index       int        // index of the color in the palette
+	axis        int        // splitting axis
+	left, right int        // child nodes, -1 if missing
+}
+
+var (
+	// rgbaWeights weights every channel equally.
+	rgbaWeights = [4]float64{1, 1, 1, 1}
+	// lumaWeights weights the color channels with the Rec. 709 (sRGB) luma coefficients.
+	lumaWeights = [4]float64{.2126, .7152, .0722, 1}
+)
+
+// newKDTree builds a k-d tree from a palette. The distance between two colors is
+// the sum of the squared channel differences, each multiplied by the corresponding weight.
+func newKDTree(palette [][4]int32, weights [4]float64) *kdTree {
+	t := &kdTree{nodes: make([]kdNode, len(palette))}
+	for i := range weights {
+		t.scale[i] = math.Sqrt(weights[i])
+	}
+	for i, p := range palette {
+		n := &t.nodes[i]
+		n.index = i
+		for ch := 0; ch < 4; ch++ {
+			n.c[ch] = float64(p[ch]) * t.scale[ch]
+		}
+	}
+	t.root = t.build(t.nodes, 0)
+	return t
+}
+
+// newPaletteTree builds a k-d tree from a color palette.
+func newPaletteTree(pal color.Palette, weights [4]float64) *kdTree {
+	return newKDTree(paletteValues(pal), weights)
+}
+
+// paletteValues returns the 16 bit R,G,B,A values of the palette colors.
+func paletteValues(pal color.Palette) [][4]int32 {
+	palette := make([][4]int32, len(pal))
+	for i, col := range pal {
+		r, g, b, a := col.RGBA()
+		palette[i] = [4]int32{int32(r), int32(g), int32(b), int32(a)}
+	}
+	return palette
+}
+
+// build arranges the nodes in place, so that the median of each sub-slice becomes
+// the root of the subtree. It returns the position of the subtree root, or -1 if empty.
+func (t *kdTree) build(nodes []kdNode, offset int) int {
+	if len(nodes) == 0 {
+		return -1
+	}
+	// Split along the axis with the widest extent.
+	axis, extent := 0, -1.0
+	for ch := 0; ch < 4; ch++ {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for i := range nodes {
+			lo = math.Min(lo, nodes[i].c[ch])
+			hi = math.Max(hi, nodes[i].c[ch])
+		}
+		if hi-lo > extent {
+			axis, extent = ch, hi-lo
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].c[axis] == nodes[j].c[axis] {
+			return nodes[i].index < nodes[j].index
+		}
+		return nodes[i].c[axis] < nodes[j].c[axis]
+	})
+	m := len(nodes) / 2
+	nodes[m].axis = axis
+	nodes[m].left = t.build(nodes[:m], offset)
+	nodes[m].right = t.build(nodes[m+1:], offset+m+1)
+	return offset + m
+}
+
+// nearest returns the palette index of the color closest to the (r, g, b, a) color.
+// On equal distances the color with the lowest palette index wins.
+func (t *kdTree) nearest(r, g, b, a int32) int {
+	if t.root < 0 {
+		return 0
+	}
+	q := [4]float64{
+		float64(r) * t.scale[0],
+		float64(g) * t.scale[1],
+		float64(b) * t.scale[2],
+		float64(a) * t.scale[3],
+	}
+	best, bestDist := -1, math.Inf(1)
+	t.search(t.root, &q, &best, &bestDist)
+	return best
+}
+
+func (t *kdTree) search(i int, q *[4]float64, best *int, bestDist *float64) {
+	if i < 0 {
+		return
+	}
+	n := &t.nodes[i]
+	var dist float64
+	for ch := 0; ch < 4; ch++ {
+		d := q[ch] - n.c[ch]
+		dist += d * d
+	}
+	if dist < *bestDist || (dist == *bestDist && n.index < *best) {
+		*best, *bestDist = n.index, dist
+	}
+	// Visit the side of the splitting plane containing the query point first,
+	// then the other side only if it can hold a closer color.
+	d := q[n.axis] - n.c[n.axis]
+	near, far := n.left, n.right
+	if d > 0 {
+		near, far = far, near
+	}
+	t.search(near, q, best, bestDist)
+	if d*d <= *bestDist {
+		t.search(far, q, best, bestDist)
+	}
+}
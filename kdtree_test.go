@@ -0,0 +1,40 @@
+package colorquant
+
+import (
+	"image/color/palette"
+	"math/rand"
+	"testing"
+)
+
+func TestKDTree_Nearest(t *testing.T) {
+	pal := paletteValues(palette.Plan9)
+	for _, weights := range [][4]float64{rgbaWeights, lumaWeights} {
+		tree := newKDTree(pal, weights)
+		rnd := rand.New(rand.NewSource(1))
+		for i := 0; i < 1000; i++ {
+			c := [4]int32{rnd.Int31n(0x10000), rnd.Int31n(0x10000), rnd.Int31n(0x10000), 0xffff}
+			// Find the closest color by scanning the whole palette.
+			best, bestDist := 0, -1.0
+			for idx, p := range pal {
+				var dist float64
+				for ch := 0; ch < 4; ch++ {
+					d := float64(c[ch] - p[ch])
+					dist += weights[ch] * d * d
+				}
+				if bestDist < 0 || dist < bestDist {
+					best, bestDist = idx, dist
+				}
+			}
+			if got := tree.nearest(c[0], c[1], c[2], c[3]); got != best {
+				t.Fatalf("Expected the closest palette index to be %d, got %d", best, got)
+			}
+		}
+	}
+}
+
+func TestKDTree_Empty(t *testing.T) {
+	tree := newKDTree(nil, rgbaWeights)
+	if idx := tree.nearest(0, 0, 0, 0); idx != 0 {
+		t.Errorf("An empty tree should return the 0 index, got %d", idx)
+	}
+}
@@ -0,0 +1,294 @@
+package colorquant
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// Metrics holds the quality metrics of a quantized or dithered image compared to its original.
+type Metrics struct {
+	ChannelMSE  [3]float64 // mean squared error of the R, G and B channels, in 8 bit units
+	MSE         float64    // mean squared error averaged over the channels
+	ChannelPSNR [3]float64 // peak signal-to-noise ratio of the R, G and B channels, in dB
+	PSNR        float64    // peak signal-to-noise ratio of the averaged MSE, in dB
+	SSIM        float64    // structural similarity index of the luminance
+	// BlurSSIM is the structural similarity of the low-pass filtered luminance. The filter simulates
+	// the viewing distance, so that dither patterns reproducing the original tones aren't penalized.
+	BlurSSIM   float64
+	MeanDeltaE float64 // average CIEDE2000 color difference
+	MaxDeltaE  float64 // maximum CIEDE2000 color difference
+}
+
+// ErrSizeMismatch is returned when comparing images of different sizes.
+var ErrSizeMismatch = errors.New("colorquant: the images should have the same size")
+
+// Compare measures the quality of the result image compared to the original one.
+// The images are compared pixel by pixel relative to their bounds.
+func Compare(original, result image.Image) (Metrics, error) {
+	var m Metrics
+	if !sameSize(original, result) {
+		return m, ErrSizeMismatch
+	}
+	m.ChannelMSE = channelMSE(original, result)
+	for i, v := range m.ChannelMSE {
+		m.MSE += v / 3
+		m.ChannelPSNR[i] = psnr(v)
+	}
+	m.PSNR = psnr(m.MSE)
+
+	w, h := original.Bounds().Dx(), original.Bounds().Dy()
+	lx, ly := luminance(original), luminance(result)
+	m.SSIM = ssim(lx, ly, w, h)
+	m.BlurSSIM = ssim(gaussianBlur(lx, w, h, 1.0), gaussianBlur(ly, w, h, 1.0), w, h)
+	m.MeanDeltaE, m.MaxDeltaE = deltaE(original, result)
+	return m, nil
+}
+
+// PSNR returns the peak signal-to-noise ratio in dB between the original and the result image.
+func PSNR(original, result image.Image) (float64, error) {
+	if !sameSize(original, result) {
+		return 0, ErrSizeMismatch
+	}
+	mse := channelMSE(original, result)
+	return psnr((mse[0] + mse[1] + mse[2]) / 3), nil
+}
+
+// DeltaE returns the average and the maximum CIEDE2000 color difference between the original and the result image.
+func DeltaE(original, result image.Image) (float64, float64, error) {
+	if !sameSize(original, result) {
+		return 0, 0, ErrSizeMismatch
+	}
+	mean, max := deltaE(original, result)
+	return mean, max, nil
+}
+
+func sameSize(a, b image.Image) bool {
+	return a.Bounds().Dx() == b.Bounds().Dx() && a.Bounds().Dy() == b.Bounds().Dy()
+}
+
+// each calls fn with the 8 bit R,G,B values of the corresponding pixels of the two images.
+func each(a, b image.Image, fn func(r1, g1, b1, r2, g2, b2 float64)) {
+	ba, bb := a.Bounds(), b.Bounds()
+	for y := 0; y < ba.Dy(); y++ {
+		for x := 0; x < ba.Dx(); x++ {
+			r1, g1, b1, _ := a.At(ba.Min.X+x, ba.Min.Y+y).RGBA()
+			r2, g2, b2, _ := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			fn(float64(r1)/257, float64(g1)/257, float64(b1)/257, float64(r2)/257, float64(g2)/257, float64(b2)/257)
+		}
+	}
+}
+
+func channelMSE(a, b image.Image) [3]float64 {
+	var sum [3]float64
+	each(a, b, func(r1, g1, b1, r2, g2, b2 float64) {
+		sum[0] += (r1 - r2) * (r1 - r2)
+		sum[1] += (g1 - g2) * (g1 - g2)
+		sum[2] += (b1 - b2) * (b1 - b2)
+	})
+	n := float64(a.Bounds().Dx() * a.Bounds().Dy())
+	if n == 0 {
+		return sum
+	}
+	return [3]float64{sum[0] / n, sum[1] / n, sum[2] / n}
+}
+
+// psnr converts a mean squared error to peak signal-to-noise ratio. Identical images have infinite PSNR.
+func psnr(mse float64) float64 {
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+func deltaE(a, b image.Image) (float64, float64) {
+	var sum, max float64
+	each(a, b, func(r1, g1, b1, r2, g2, b2 float64) {
+		d := ciede2000(lab(r1, g1, b1), lab(r2, g2, b2))
+		sum += d
+		if d > max {
+			max = d
+		}
+	})
+	n := float64(a.Bounds().Dx() * a.Bounds().Dy())
+	if n == 0 {
+		return 0, 0
+	}
+	return sum / n, max
+}
+
+// luminance returns the Rec. 601 luma of the image pixels in 8 bit units.
+func luminance(img image.Image) []float64 {
+	b := img.Bounds()
+	l := make([]float64, 0, b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			l = append(l, (0.299*float64(r)+0.587*float64(g)+0.114*float64(bl))/257)
+		}
+	}
+	return l
+}
+
+// gaussianBlur filters the w x h values with a separable Gaussian kernel, extending the edges.
+func gaussianBlur(v []float64, w, h int, sigma float64) []float64 {
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	var sum float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	clampInt := func(v, lo, hi int) int {
+		if v < lo {
+			return lo
+		}
+		if v > hi {
+			return hi
+		}
+		return v
+	}
+	tmp := make([]float64, len(v))
+	out := make([]float64, len(v))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var s float64
+			for k, kv := range kernel {
+				s += kv * v[y*w+clampInt(x+k-radius, 0, w-1)]
+			}
+			tmp[y*w+x] = s
+		}
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var s float64
+			for k, kv := range kernel {
+				s += kv * tmp[clampInt(y+k-radius, 0, h-1)*w+x]
+			}
+			out[y*w+x] = s
+		}
+	}
+	return out
+}
+
+// ssim returns the mean structural similarity index of two w x h luminance planes,
+// using a Gaussian window with a standard deviation of 1.5 pixels.
+func ssim(x, y []float64, w, h int) float64 {
+	if len(x) == 0 {
+		return 1
+	}
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+	xx := make([]float64, len(x))
+	yy := make([]float64, len(x))
+	xy := make([]float64, len(x))
+	for i := range x {
+		xx[i] = x[i] * x[i]
+		yy[i] = y[i] * y[i]
+		xy[i] = x[i] * y[i]
+	}
+	mx, my := gaussianBlur(x, w, h, 1.5), gaussianBlur(y, w, h, 1.5)
+	sxx, syy, sxy := gaussianBlur(xx, w, h, 1.5), gaussianBlur(yy, w, h, 1.5), gaussianBlur(xy, w, h, 1.5)
+
+	var sum float64
+	for i := range x {
+		vx := sxx[i] - mx[i]*mx[i]
+		vy := syy[i] - my[i]*my[i]
+		cov := sxy[i] - mx[i]*my[i]
+		sum += ((2*mx[i]*my[i] + c1) * (2*cov + c2)) / ((mx[i]*mx[i] + my[i]*my[i] + c1) * (vx + vy + c2))
+	}
+	return sum / float64(len(x))
+}
+
+// lab converts 8 bit sRGB values to CIE L*a*b* under the D65 illuminant.
+func lab(r, g, b float64) [3]float64 {
+	lin := func(v float64) float64 {
+		v /= 255
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	rl, gl, bl := lin(r), lin(g), lin(b)
+	x := (0.4124564*rl + 0.3575761*gl + 0.1804375*bl) / 0.95047
+	y := 0.2126729*rl + 0.7151522*gl + 0.0721750*bl
+	z := (0.0193339*rl + 0.1191920*gl + 0.9503041*bl) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// ciede2000 returns the CIEDE2000 color difference of two L*a*b* colors.
+func ciede2000(c1, c2 [3]float64) float64 {
+	l1, a1, b1 := c1[0], c1[1], c1[2]
+	l2, a2, b2 := c2[0], c2[1], c2[2]
+
+	cab := (math.Hypot(a1, b1) + math.Hypot(a2, b2)) / 2
+	cab7 := math.Pow(cab, 7)
+	g := 0.5 * (1 - math.Sqrt(cab7/(cab7+math.Pow(25, 7))))
+	a1p, a2p := (1+g)*a1, (1+g)*a2
+	c1p, c2p := math.Hypot(a1p, b1), math.Hypot(a2p, b2)
+
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) * 180 / math.Pi
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	h1p, h2p := hue(b1, a1p), hue(b2, a2p)
+
+	dl := l2 - l1
+	dc := c2p - c1p
+	var dh float64
+	if c1p*c2p != 0 {
+		dh = h2p - h1p
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(c1p*c2p) * math.Sin(dh/2*math.Pi/180)
+
+	lm := (l1 + l2) / 2
+	cm := (c1p + c2p) / 2
+	hm := h1p + h2p
+	if c1p*c2p != 0 {
+		if math.Abs(h1p-h2p) > 180 {
+			if hm < 360 {
+				hm += 360
+			} else {
+				hm -= 360
+			}
+		}
+		hm /= 2
+	}
+	rad := math.Pi / 180
+	t := 1 - 0.17*math.Cos((hm-30)*rad) + 0.24*math.Cos(2*hm*rad) +
+		0.32*math.Cos((3*hm+6)*rad) - 0.20*math.Cos((4*hm-63)*rad)
+	dtheta := 30 * math.Exp(-((hm-275)/25)*((hm-275)/25))
+	cm7 := math.Pow(cm, 7)
+	rc := 2 * math.Sqrt(cm7/(cm7+math.Pow(25, 7)))
+	sl := 1 + 0.015*(lm-50)*(lm-50)/math.Sqrt(20+(lm-50)*(lm-50))
+	sc := 1 + 0.045*cm
+	sh := 1 + 0.015*cm*t
+	rt := -math.Sin(2*dtheta*rad) * rc
+
+	return math.Sqrt((dl/sl)*(dl/sl) + (dc/sc)*(dc/sc) + (dH/sh)*(dH/sh) + rt*(dc/sc)*(dH/sh))
+}
@@ -0,0 +1,63 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestCIEDE2000(t *testing.T) {
+	// Test pairs from Sharma, Wu and Dalal: The CIEDE2000 color-difference formula.
+	pairs := []struct {
+		c1, c2 [3]float64
+		want   float64
+	}{
+		{[3]float64{50, 2.6772, -79.7751}, [3]float64{50, 0, -82.7485}, 2.0425},
+		{[3]float64{50, 0, 0}, [3]float64{50, -1, 2}, 2.3669},
+		{[3]float64{50, 2.5, 0}, [3]float64{73, 25, -18}, 27.1492},
+		{[3]float64{2.0776, 0.0795, -1.1350}, [3]float64{0.9033, -0.0636, -0.5514}, 0.9082},
+	}
+	for _, p := range pairs {
+		if got := ciede2000(p.c1, p.c2); math.Abs(got-p.want) > 1e-4 {
+			t.Errorf("Expected ΔE %.4f between %v and %v, got %.4f", p.want, p.c1, p.c2, got)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 16), 0x80, 0xff})
+		}
+	}
+	m, err := Compare(img, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(m.PSNR, 1) || m.MSE != 0 || m.MaxDeltaE != 0 || math.Abs(m.SSIM-1) > 1e-9 {
+		t.Errorf("Identical images should have perfect metrics, got %+v", m)
+	}
+
+	// Shift the red channel of every pixel by 4 levels.
+	res := image.NewRGBA(img.Bounds())
+	copy(res.Pix, img.Pix)
+	for i := 0; i < len(res.Pix); i += 4 {
+		res.Pix[i] += 4
+	}
+	m, _ = Compare(img, res)
+	if m.ChannelMSE[0] != 16 || m.ChannelMSE[1] != 0 {
+		t.Errorf("Expected a red channel MSE of 16, got %v", m.ChannelMSE)
+	}
+	if want := 10 * math.Log10(255*255/(16.0/3)); math.Abs(m.PSNR-want) > 1e-9 {
+		t.Errorf("Expected PSNR %.2f, got %.2f", want, m.PSNR)
+	}
+	if m.MeanDeltaE <= 0 || m.MaxDeltaE < m.MeanDeltaE || m.SSIM >= 1 {
+		t.Errorf("Unexpected metrics of different images: %+v", m)
+	}
+
+	if _, err := Compare(img, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != ErrSizeMismatch {
+		t.Errorf("Expected %v, got %v", ErrSizeMismatch, err)
+	}
+}
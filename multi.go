@@ -0,0 +1,94 @@
+package colorquant
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"sort"
+)
+
+// ErrImageWeights is the panic value of SharedPalette when the number of weights differs from the number of images.
+var ErrImageWeights = errors.New("colorquant: the number of weights should match the number of images")
+
+// SharedPalette computes a single palette of at most nq colors optimized over all the images,
+// for example the frames of an animation or the images of a sprite sheet. The optional weights
+// set the relative importance of the pixels of each image; nil weights every pixel equally.
+// It panics with ErrImageWeights if the weights are not nil and their number differs from the number of images.
+// The images can then be mapped onto the palette with Remap.
+func (q Quant) SharedPalette(imgs []image.Image, weights []float64, nq int) color.Palette {
+	if weights != nil && len(weights) != len(imgs) {
+		panic(ErrImageWeights)
+	}
+	if len(imgs) == 0 {
+		return nil
+	}
+	at := newAtlas(imgs)
+	at.weights = weights
+	qz := q.workspace(at, nq)
+	qz.cluster()
+
+	es := qz.entries()
+	p := make(color.Palette, len(es))
+	for i, e := range es {
+		p[i] = e.c
+	}
+	return p
+}
+
+// Remap maps the source image onto a fixed palette using the given quantizer,
+// which can be any of the dithering methods or NoDither.
+func Remap(src image.Image, p color.Palette, q Quantizer, useDither bool) *image.Paletted {
+	dst := image.NewPaletted(src.Bounds(), p)
+	q.Quantize(src, dst, len(p), useDither, false)
+	return dst
+}
+
+// atlas is a virtual image, which stacks several images on top of each other,
+// so that the pixels of all of them can be clustered at once.
+type atlas struct {
+	imgs    []image.Image
+	offsets []int     // vertical offset of each image in the atlas
+	weights []float64 // weight of the pixels of each image, nil if unweighted
+	rect    image.Rectangle
+}
+
+func newAtlas(imgs []image.Image) *atlas {
+	a := &atlas{
+		imgs:    imgs,
+		offsets: make([]int, len(imgs)),
+	}
+	for i, img := range imgs {
+		b := img.Bounds()
+		a.offsets[i] = a.rect.Max.Y
+		a.rect.Max.Y += b.Dy()
+		if b.Dx() > a.rect.Max.X {
+			a.rect.Max.X = b.Dx()
+		}
+	}
+	return a
+}
+
+func (a *atlas) ColorModel() color.Model { return color.RGBA64Model }
+
+func (a *atlas) Bounds() image.Rectangle { return a.rect }
+
+func (a *atlas) At(x, y int) color.Color {
+	i := a.index(y)
+	b := a.imgs[i].Bounds()
+	return a.imgs[i].At(b.Min.X+x, b.Min.Y+y-a.offsets[i])
+}
+
+// index returns the index of the image containing the atlas row y.
+func (a *atlas) index(y int) int {
+	return sort.Search(len(a.offsets), func(i int) bool { return a.offsets[i] > y }) - 1
+}
+
+// rects returns the atlas rectangles covered by the images.
+func (a *atlas) rects() []image.Rectangle {
+	rects := make([]image.Rectangle, len(a.imgs))
+	for i, img := range a.imgs {
+		b := img.Bounds()
+		rects[i] = image.Rect(0, a.offsets[i], b.Dx(), a.offsets[i]+b.Dy())
+	}
+	return rects
+}
@@ -0,0 +1,61 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solid(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func sameColor(c1, c2 color.Color) bool {
+	r1, g1, b1, a1 := c1.RGBA()
+	r2, g2, b2, a2 := c2.RGBA()
+	return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+}
+
+func TestQuant_SharedPalette(t *testing.T) {
+	red := solid(4, 4, color.RGBA{0xff, 0, 0, 0xff})
+	blue := solid(8, 2, color.RGBA{0, 0, 0xff, 0xff})
+	imgs := []image.Image{red, blue}
+
+	p := Quant{}.SharedPalette(imgs, nil, 4)
+	if len(p) != 2 {
+		t.Fatalf("Expected a shared palette of 2 colors, got %d", len(p))
+	}
+	for _, img := range imgs {
+		res := Remap(img, p, NoDither, false)
+		want := img.At(0, 0)
+		for _, idx := range res.Pix {
+			if !sameColor(p[idx], want) {
+				t.Fatalf("The image should be mapped to %v, got %v", want, p[idx])
+			}
+		}
+	}
+}
+
+func TestQuant_SharedPaletteWeights(t *testing.T) {
+	red := solid(1, 1, color.RGBA{0xff, 0, 0, 0xff})
+	blue := solid(1, 1, color.RGBA{0, 0, 0xff, 0xff})
+
+	p := Quant{}.SharedPalette([]image.Image{red, blue}, []float64{1, 3}, 1)
+	r, _, b, _ := p[0].RGBA()
+	if r>>8 != 0x40 || b>>8 != 0xbf {
+		t.Errorf("The palette color should be weighted towards blue, got R:%#x B:%#x", r>>8, b>>8)
+	}
+
+	defer func() {
+		if r := recover(); r != ErrImageWeights {
+			t.Errorf("SharedPalette should panic with %v, got %v", ErrImageWeights, r)
+		}
+	}()
+	Quant{}.SharedPalette([]image.Image{red, blue}, []float64{1}, 1)
+}
@@ -0,0 +1,196 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// PaletteOrder is the order of the colors in the palette of the quantized image.
+// The order affects the compressed size of PNG and GIF files, and the palette animation effects.
+type PaletteOrder int
+
+const (
+	// OrderCreation keeps the order the clusters have been created in by the median cut.
+	OrderCreation PaletteOrder = iota
+	// OrderLuminance sorts the colors from dark to light.
+	OrderLuminance
+	// OrderHue sorts the colors by hue, starting with red. The grays come first, from dark to light.
+	OrderHue
+	// OrderFrequency sorts the colors by decreasing number of pixels.
+	OrderFrequency
+	// OrderPath starts with the darkest color, and always continues with the nearest color not visited yet,
+	// which gives smooth ramps. The cost is quadratic in the number of colors.
+	OrderPath
+	// OrderValue sorts the colors by their R, G, B and A values. The order depends only on the colors
+	// of the palette, not on the way they have been found.
+	OrderValue
+)
+
+// orderPalette returns the permutation of the colors according to the order:
+// the i-th color of the ordered palette is the perm[i]-th color of the palette.
+// The counts hold the number of pixels of each color. The ties are broken by palette index.
+func orderPalette(p color.Palette, counts []int, order PaletteOrder) []int {
+	if order == OrderPath {
+		return pathOrder(p)
+	}
+	perm := make([]int, len(p))
+	for i := range perm {
+		perm[i] = i
+	}
+	keys := make([][4]float64, len(p))
+	for i, c := range p {
+		r, g, b, a := c.RGBA()
+		switch order {
+		case OrderLuminance:
+			keys[i][0] = luma(r, g, b)
+		case OrderHue:
+			h, gray := hue(r, g, b)
+			if gray {
+				h = -1
+			}
+			keys[i][0], keys[i][1] = h, luma(r, g, b)
+		case OrderFrequency:
+			keys[i][0] = -float64(counts[i])
+		case OrderValue:
+			keys[i] = [4]float64{float64(r), float64(g), float64(b), float64(a)}
+		default:
+			return perm
+		}
+	}
+	sort.SliceStable(perm, func(i, j int) bool {
+		ki, kj := &keys[perm[i]], &keys[perm[j]]
+		for k := range ki {
+			if ki[k] != kj[k] {
+				return ki[k] < kj[k]
+			}
+		}
+		return false
+	})
+	return perm
+}
+
+// pathOrder returns the order of the nearest neighbor path through the colors, starting with the darkest one.
+func pathOrder(p color.Palette) []int {
+	perm := make([]int, 0, len(p))
+	if len(p) == 0 {
+		return perm
+	}
+	colors := paletteValues(p)
+	visited := make([]bool, len(p))
+	cur, best := 0, math.Inf(1)
+	for i, c := range colors {
+		if l := luma(uint32(c[0]), uint32(c[1]), uint32(c[2])); l < best {
+			cur, best = i, l
+		}
+	}
+	for {
+		visited[cur] = true
+		perm = append(perm, cur)
+		next, dist := -1, math.Inf(1)
+		for i, c := range colors {
+			if visited[i] {
+				continue
+			}
+			var d float64
+			for ch := range c {
+				v := float64(c[ch] - colors[cur][ch])
+				d += v * v
+			}
+			if d < dist {
+				next, dist = i, d
+			}
+		}
+		if next < 0 {
+			return perm
+		}
+		cur = next
+	}
+}
+
+// luma returns the Rec. 709 luminance of a 16 bit color.
+func luma(r, g, b uint32) float64 {
+	return lumaWeights[0]*float64(r) + lumaWeights[1]*float64(g) + lumaWeights[2]*float64(b)
+}
+
+// hue returns the HSV hue of a 16 bit color in degrees, and whether the color is a gray.
+func hue(r, g, b uint32) (float64, bool) {
+	fr, fg, fb := float64(r), float64(g), float64(b)
+	max := math.Max(fr, math.Max(fg, fb))
+	min := math.Min(fr, math.Min(fg, fb))
+	d := max - min
+	if d == 0 {
+		return 0, true
+	}
+	var h float64
+	switch max {
+	case fr:
+		h = math.Mod((fg-fb)/d, 6)
+	case fg:
+		h = (fb-fr)/d + 2
+	default:
+		h = (fr-fg)/d + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+	return h, false
+}
+
+// SortPalette reorders the palette of the image according to the order, and remaps
+// the pixel indices to match, so that the image looks the same. The image gets a new
+// palette, the original one may be shared with other images. It returns ErrTooManyColors
+// if the palette has more than 256 colors, which can't all be addressed by the indices.
+func SortPalette(img *image.Paletted, order PaletteOrder) error {
+	if len(img.Palette) > 256 {
+		return ErrTooManyColors
+	}
+	b := img.Bounds()
+	counts := make([]int, len(img.Palette))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for _, i := range img.Pix[img.PixOffset(b.Min.X, y):img.PixOffset(b.Max.X, y)] {
+			if int(i) < len(counts) {
+				counts[i]++
+			}
+		}
+	}
+	perm := orderPalette(img.Palette, counts, order)
+	var remap [256]uint8
+	for i := range remap {
+		remap[i] = uint8(i)
+	}
+	p := make(color.Palette, len(perm))
+	for i, j := range perm {
+		p[i] = img.Palette[j]
+		remap[j] = uint8(i)
+	}
+	img.Palette = p
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(b.Min.X, y):img.PixOffset(b.Max.X, y)]
+		for i, v := range row {
+			row[i] = remap[v]
+		}
+	}
+	return nil
+}
+
+// order sorts the cluster entries according to the palette order of the work space.
+// The fixed colors keep the first palette slots.
+func (qz *Quant) order(es []entry) {
+	if qz.Order == OrderCreation {
+		return
+	}
+	cs := es[len(qz.Fixed):]
+	p := make(color.Palette, len(cs))
+	counts := make([]int, len(cs))
+	for i, e := range cs {
+		p[i], counts[i] = e.c, len(e.px)
+	}
+	sorted := make([]entry, len(cs))
+	for i, j := range orderPalette(p, counts, qz.Order) {
+		sorted[i] = cs[j]
+	}
+	copy(cs, sorted)
+}
@@ -0,0 +1,130 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// samePixels reports whether the two images have the same colors at every pixel.
+func samePixels(a, b image.Image) bool {
+	bd := a.Bounds()
+	for y := bd.Min.Y; y < bd.Max.Y; y++ {
+		for x := bd.Min.X; x < bd.Max.X; x++ {
+			if !sameColor(a.At(x, y), b.At(x, y)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestQuant_Order(t *testing.T) {
+	img := noisy(5, 32, 32)
+	base := Quant{}.Quantize(img, 16).(*image.Paletted)
+	orders := []PaletteOrder{OrderLuminance, OrderHue, OrderFrequency, OrderPath, OrderValue}
+	for _, order := range orders {
+		res := Quant{Order: order}.Quantize(img, 16).(*image.Paletted)
+		if !samePixels(base, res) {
+			t.Errorf("Order %d: the pixel indices should be remapped to the reordered palette", order)
+		}
+		if len(res.Palette) != len(base.Palette) {
+			t.Errorf("Order %d: expected %d colors, got %d", order, len(base.Palette), len(res.Palette))
+		}
+	}
+
+	res := Quant{Order: OrderLuminance}.Quantize(img, 16).(*image.Paletted)
+	for i := 1; i < len(res.Palette); i++ {
+		r0, g0, b0, _ := res.Palette[i-1].RGBA()
+		r1, g1, b1, _ := res.Palette[i].RGBA()
+		if luma(r0, g0, b0) > luma(r1, g1, b1) {
+			t.Errorf("The colors should be sorted by luminance: %v", res.Palette)
+			break
+		}
+	}
+
+	res = Quant{Order: OrderFrequency}.Quantize(img, 16).(*image.Paletted)
+	counts := make([]int, len(res.Palette))
+	for _, i := range res.Pix {
+		counts[i]++
+	}
+	for i := 1; i < len(counts); i++ {
+		if counts[i-1] < counts[i] {
+			t.Errorf("The colors should be sorted by decreasing frequency: %v", counts)
+			break
+		}
+	}
+}
+
+func TestOrderPalette(t *testing.T) {
+	p := color.Palette{
+		color.RGBA{0, 0, 0xff, 0xff},       // blue
+		color.RGBA{0x80, 0x80, 0x80, 0xff}, // gray
+		color.RGBA{0xff, 0, 0, 0xff},       // red
+		color.RGBA{0, 0, 0, 0xff},          // black
+		color.RGBA{0, 0xff, 0, 0xff},       // green
+	}
+	counts := []int{1, 5, 3, 2, 4}
+	tests := []struct {
+		order PaletteOrder
+		want  []int
+	}{
+		{OrderCreation, []int{0, 1, 2, 3, 4}},
+		{OrderLuminance, []int{3, 0, 2, 1, 4}},
+		{OrderHue, []int{3, 1, 2, 4, 0}},
+		{OrderFrequency, []int{1, 4, 2, 3, 0}},
+		{OrderValue, []int{3, 0, 4, 1, 2}},
+		{OrderPath, []int{3, 1, 0, 2, 4}},
+	}
+	for _, tt := range tests {
+		got := orderPalette(p, counts, tt.order)
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Order %d: expected %v, got %v", tt.order, tt.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestQuant_OrderFixed(t *testing.T) {
+	fixed := color.Palette{color.RGBA{0xff, 0xff, 0xff, 0xff}}
+	res := Quant{Fixed: fixed, Order: OrderLuminance}.Quantize(noisy(6, 16, 16), 8).(*image.Paletted)
+	if !sameColor(res.Palette[0], fixed[0]) {
+		t.Errorf("The fixed color should keep the first slot, got %v", res.Palette[0])
+	}
+}
+
+func TestSortPalette(t *testing.T) {
+	img := noisy(7, 32, 32)
+	res := Quant{}.Quantize(img, 16).(*image.Paletted)
+	orig := append(color.Palette(nil), res.Palette...)
+	shared := res.Palette
+
+	sorted := image.NewPaletted(res.Bounds(), res.Palette)
+	copy(sorted.Pix, res.Pix)
+	if err := SortPalette(sorted, OrderValue); err != nil {
+		t.Fatal(err)
+	}
+	if !samePixels(res, sorted) {
+		t.Error("The pixel indices should be remapped to the sorted palette")
+	}
+	for i := range shared {
+		if shared[i] != orig[i] {
+			t.Fatal("The original palette should not be modified")
+		}
+	}
+	for i := 1; i < len(sorted.Palette); i++ {
+		r0, _, _, _ := sorted.Palette[i-1].RGBA()
+		r1, _, _, _ := sorted.Palette[i].RGBA()
+		if r0 > r1 {
+			t.Errorf("The colors should be sorted by value: %v", sorted.Palette)
+			break
+		}
+	}
+
+	large := image.NewPaletted(res.Bounds(), PosterizeBits(3, 3, 3).Palette())
+	if err := SortPalette(large, OrderLuminance); err != ErrTooManyColors {
+		t.Errorf("Expected %v for a palette of %d colors, got %v", ErrTooManyColors, len(large.Palette), err)
+	}
+}
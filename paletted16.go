@@ -0,0 +1,157 @@
+package colorquant
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+// MaxColors is the maximum number of palette colors supported by the quantizer.
+const MaxColors = 1 << 16
+
+// ErrTooManyColors is returned when the requested number of colors doesn't fit in the index size of the target image.
+var ErrTooManyColors = errors.New("colorquant: too many colors for the target index size")
+
+// Paletted16 is an in-memory image of uint16 indices into a given palette.
+// It's the counterpart of image.Paletted for palettes of up to 65536 colors.
+type Paletted16 struct {
+	// Pix holds the image's pixels, as palette indices. The pixel at
+	// (x, y) is at Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)].
+	Pix []uint16
+	// Stride is the Pix stride (in indices) between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+	// Palette is the image's palette.
+	Palette color.Palette
+}
+
+// NewPaletted16 returns a new Paletted16 image with the given width, height and palette.
+func NewPaletted16(r image.Rectangle, p color.Palette) *Paletted16 {
+	w, h := r.Dx(), r.Dy()
+	return &Paletted16{
+		Pix:     make([]uint16, w*h),
+		Stride:  w,
+		Rect:    r,
+		Palette: p,
+	}
+}
+
+func (p *Paletted16) ColorModel() color.Model { return p.Palette }
+
+func (p *Paletted16) Bounds() image.Rectangle { return p.Rect }
+
+func (p *Paletted16) At(x, y int) color.Color {
+	if len(p.Palette) == 0 {
+		return nil
+	}
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return p.Palette[0]
+	}
+	return p.Palette[p.Pix[p.PixOffset(x, y)]]
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to the pixel at (x, y).
+func (p *Paletted16) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x - p.Rect.Min.X)
+}
+
+func (p *Paletted16) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	p.Pix[p.PixOffset(x, y)] = uint16(p.Palette.Index(c))
+}
+
+// ColorIndexAt returns the palette index of the pixel at (x, y).
+func (p *Paletted16) ColorIndexAt(x, y int) uint16 {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return 0
+	}
+	return p.Pix[p.PixOffset(x, y)]
+}
+
+// SetColorIndex sets the palette index of the pixel at (x, y).
+func (p *Paletted16) SetColorIndex(x, y int, index uint16) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	p.Pix[p.PixOffset(x, y)] = index
+}
+
+// Paletted16 generates an image with 16 bit palette indices from the clusters.
+// It panics if the palette has more than MaxColors colors.
+func (qz *Quant) Paletted16() *Paletted16 {
+	es := qz.entries()
+	if len(es) > MaxColors {
+		panic(ErrTooManyColors)
+	}
+	cp := make(color.Palette, len(es))
+	pi := NewPaletted16(qz.img.Bounds(), cp)
+	for i, e := range es {
+		cp[i] = e.c
+		for _, p := range e.px {
+			pi.SetColorIndex(p.x, p.y, uint16(i))
+		}
+	}
+	return pi
+}
+
+// QuantizePaletted quantizes the image to nq colors and returns an image.Paletted. It returns
+// ErrTooManyColors if nq or the fixed colors don't fit in the 8 bit indices of image.Paletted,
+// and ErrWeights if the weight map doesn't have the size of the image.
+func (q Quant) QuantizePaletted(img image.Image, nq int) (*image.Paletted, error) {
+	if q.paletteSize(nq) > 256 {
+		return nil, ErrTooManyColors
+	}
+	if err := q.checkWeights(img); err != nil {
+		return nil, err
+	}
+	qz := q.workspace(img, nq)
+	qz.cluster()
+	return qz.Paletted().(*image.Paletted), nil
+}
+
+// Quantize16 quantizes the image to nq colors and returns an image with 16 bit palette indices.
+// It returns ErrTooManyColors if nq or the fixed colors don't fit in 65536 colors,
+// and ErrWeights if the weight map doesn't have the size of the image.
+func (q Quant) Quantize16(img image.Image, nq int) (*Paletted16, error) {
+	if q.paletteSize(nq) > MaxColors {
+		return nil, ErrTooManyColors
+	}
+	if err := q.checkWeights(img); err != nil {
+		return nil, err
+	}
+	qz := q.workspace(img, nq)
+	qz.cluster()
+	return qz.Paletted16(), nil
+}
+
+// paletteSize returns the maximum palette size of the quantization to nq colors. The fixed
+// colors always keep their slots, if they fill all the nq colors no cluster is made.
+func (q Quant) paletteSize(nq int) int {
+	if len(q.Fixed) > nq {
+		return len(q.Fixed)
+	}
+	return nq
+}
+
+// result returns the image generated from the clusters of the quantization to nq colors:
+// an *image.Paletted if the requested palette fits in 8 bit indices, otherwise a *Paletted16.
+func (qz *Quant) result(nq int) image.Image {
+	if qz.paletteSize(nq) > 256 {
+		return qz.Paletted16()
+	}
+	return qz.Paletted().(image.Image)
+}
+
+// paletteOf returns the palette of an image returned by the quantizer.
+func paletteOf(img image.Image) color.Palette {
+	switch p := img.(type) {
+	case *image.Paletted:
+		return p.Palette
+	case *Paletted16:
+		return p.Palette
+	}
+	return nil
+}
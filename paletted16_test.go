@@ -0,0 +1,95 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQuant_Quantize16(t *testing.T) {
+	img := gradient(64, 64)
+	res, err := Quant{}.Quantize16(img, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Palette) <= 256 {
+		t.Fatalf("Expected more than 256 colors, got %d", len(res.Palette))
+	}
+	// Every pixel should be mapped to a valid palette entry close to its original color.
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			idx := res.ColorIndexAt(x, y)
+			if int(idx) >= len(res.Palette) {
+				t.Fatalf("Invalid palette index %d", idx)
+			}
+		}
+	}
+	if psnr, _ := PSNR(img, res); psnr < 40 {
+		t.Errorf("Expected a PSNR above 40 dB, got %.2f", psnr)
+	}
+	if _, ok := (Quant{}).Quantize(img, 1000).(*Paletted16); !ok {
+		t.Error("Quantize should return a *Paletted16 for more than 256 colors")
+	}
+}
+
+func TestQuant_QuantizeType(t *testing.T) {
+	// The image has only a few colors, the type follows the requested number of colors.
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i%4) * 0x40
+	}
+	res, ok := (Quant{}).Quantize(img, 1000).(*Paletted16)
+	if !ok {
+		t.Fatal("Quantize should return a *Paletted16 for more than 256 requested colors")
+	}
+	if len(res.Palette) != 4 {
+		t.Errorf("Expected 4 colors, got %d", len(res.Palette))
+	}
+	if _, ok := (Quant{}).Quantize(img, 256).(*image.Paletted); !ok {
+		t.Error("Quantize should return an *image.Paletted for 256 requested colors")
+	}
+	// The number of colors is clamped to MaxColors.
+	if _, ok := (Quant{}).Quantize(img, MaxColors+1).(*Paletted16); !ok {
+		t.Error("Quantize should return a *Paletted16 above MaxColors")
+	}
+}
+
+func TestQuant_TooManyColors(t *testing.T) {
+	img := gradient(8, 8)
+	if _, err := (Quant{}).QuantizePaletted(img, 300); err != ErrTooManyColors {
+		t.Errorf("Expected %v, got %v", ErrTooManyColors, err)
+	}
+	if _, err := (Quant{}).Quantize16(img, MaxColors+1); err != ErrTooManyColors {
+		t.Errorf("Expected %v, got %v", ErrTooManyColors, err)
+	}
+	if p, err := (Quant{}).QuantizePaletted(img, 16); err != nil || len(p.Palette) != 16 {
+		t.Errorf("Expected a palette of 16 colors, got %v", err)
+	}
+	// The fixed colors keep their slots even if they exceed the requested number of colors.
+	fixed := make(color.Palette, 257)
+	for i := range fixed {
+		fixed[i] = color.Gray16{uint16(i * 0xff)}
+	}
+	if _, err := (Quant{Fixed: fixed}).QuantizePaletted(img, 16); err != ErrTooManyColors {
+		t.Errorf("Expected %v with 257 fixed colors, got %v", ErrTooManyColors, err)
+	}
+	if p, err := (Quant{Fixed: fixed[:256]}).QuantizePaletted(img, 16); err != nil || len(p.Palette) != 256 {
+		t.Errorf("Expected a palette of 256 colors with 256 fixed colors, got %v", err)
+	}
+	qz := Quant{Fixed: fixed}.workspace(img, 16)
+	qz.cluster()
+	defer func() {
+		if r := recover(); r != ErrTooManyColors {
+			t.Errorf("Paletted should panic with %v, got %v", ErrTooManyColors, r)
+		}
+	}()
+	qz.Paletted()
+}
+
+func TestPaletted16_Set(t *testing.T) {
+	p := NewPaletted16(image.Rect(0, 0, 2, 2), color.Palette{color.Black, color.White})
+	p.Set(1, 1, color.RGBA{0xf0, 0xf0, 0xf0, 0xff})
+	if p.ColorIndexAt(1, 1) != 1 || p.At(0, 0) != color.Black {
+		t.Error("Unexpected palette indices")
+	}
+}
@@ -0,0 +1,522 @@
+package colorquant
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// PaletteFormat is a palette file format.
+type PaletteFormat int
+
+const (
+	// GPL is the GIMP palette format.
+	GPL PaletteFormat = iota
+	// ACT is the Adobe Color Table format.
+	ACT
+	// ACO is the Adobe Photoshop Color Swatch format.
+	ACO
+	// ASE is the Adobe Swatch Exchange format.
+	ASE
+	// JASC is the JASC-PAL format of Paint Shop Pro, also used by Aseprite.
+	JASC
+	// PaintNET is the Paint.NET TXT palette format.
+	PaintNET
+	// Hex is a plain list of hexadecimal RRGGBB or RRGGBBAA colors, one per line.
+	Hex
+)
+
+// ErrPaletteFormat is returned when a palette file is malformed or not supported.
+var ErrPaletteFormat = errors.New("colorquant: invalid palette file")
+
+// FormatByExt returns the palette format associated with the extension of the file name.
+func FormatByExt(name string) (PaletteFormat, bool) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gpl":
+		return GPL, true
+	case ".act":
+		return ACT, true
+	case ".aco":
+		return ACO, true
+	case ".ase":
+		return ASE, true
+	case ".pal":
+		return JASC, true
+	case ".txt":
+		return PaintNET, true
+	case ".hex":
+		return Hex, true
+	}
+	return 0, false
+}
+
+// ReadPalette reads a palette in the given format.
+// The imported palette can be used as the fixed palette of the destination image of Dither.Quantize.
+func ReadPalette(r io.Reader, format PaletteFormat) (color.Palette, error) {
+	switch format {
+	case GPL:
+		return readGPL(r)
+	case ACT:
+		return readACT(r)
+	case ACO:
+		return readACO(r)
+	case ASE:
+		return readASE(r)
+	case JASC:
+		return readJASC(r)
+	case PaintNET:
+		return readPaintNET(r)
+	case Hex:
+		return readHex(r)
+	}
+	return nil, ErrPaletteFormat
+}
+
+// WritePalette writes the palette in the given format.
+func WritePalette(w io.Writer, p color.Palette, format PaletteFormat) error {
+	switch format {
+	case GPL:
+		return writeGPL(w, p)
+	case ACT:
+		return writeACT(w, p)
+	case ACO:
+		return writeACO(w, p)
+	case ASE:
+		return writeASE(w, p)
+	case JASC:
+		return writeJASC(w, p)
+	case PaintNET:
+		return writePaintNET(w, p)
+	case Hex:
+		return writeHex(w, p)
+	}
+	return ErrPaletteFormat
+}
+
+// colorName returns the name of a color used by the formats storing color names.
+func colorName(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func nrgba(c color.Color) color.NRGBA {
+	return color.NRGBAModel.Convert(c).(color.NRGBA)
+}
+
+// lines returns the trimmed, non empty lines of a text file.
+func lines(r io.Reader) ([]string, error) {
+	var ls []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if l := strings.TrimSpace(sc.Text()); l != "" {
+			ls = append(ls, l)
+		}
+	}
+	return ls, sc.Err()
+}
+
+// parseRGB parses the first three whitespace separated decimal values of a line.
+func parseRGB(l string) (color.NRGBA, error) {
+	f := strings.Fields(l)
+	if len(f) < 3 {
+		return color.NRGBA{}, fmt.Errorf("colorquant: invalid color %q", l)
+	}
+	var v [3]uint8
+	for i := range v {
+		n, err := strconv.ParseUint(f[i], 10, 8)
+		if err != nil {
+			return color.NRGBA{}, fmt.Errorf("colorquant: invalid color %q", l)
+		}
+		v[i] = uint8(n)
+	}
+	return color.NRGBA{v[0], v[1], v[2], 0xff}, nil
+}
+
+func readGPL(r io.Reader) (color.Palette, error) {
+	ls, err := lines(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(ls) == 0 || ls[0] != "GIMP Palette" {
+		return nil, ErrPaletteFormat
+	}
+	var p color.Palette
+	for _, l := range ls[1:] {
+		if strings.HasPrefix(l, "#") || strings.HasPrefix(l, "Name:") || strings.HasPrefix(l, "Columns:") {
+			continue
+		}
+		c, err := parseRGB(l)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, c)
+	}
+	return p, nil
+}
+
+func writeGPL(w io.Writer, p color.Palette) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "GIMP Palette\nName: colorquant\nColumns: 16\n#\n")
+	for _, c := range p {
+		n := nrgba(c)
+		fmt.Fprintf(bw, "%3d %3d %3d\t%s\n", n.R, n.G, n.B, colorName(n))
+	}
+	return bw.Flush()
+}
+
+func readACT(r io.Reader) (color.Palette, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 768 && len(data) != 772 {
+		return nil, ErrPaletteFormat
+	}
+	// The optional trailer holds the number of colors and the index of the transparent color.
+	count, transparent := 256, -1
+	if len(data) == 772 {
+		count = int(binary.BigEndian.Uint16(data[768:]))
+		if t := binary.BigEndian.Uint16(data[770:]); t != 0xffff {
+			transparent = int(t)
+		}
+		if count == 0 || count > 256 {
+			count = 256
+		}
+	}
+	p := make(color.Palette, count)
+	for i := range p {
+		c := color.NRGBA{data[i*3], data[i*3+1], data[i*3+2], 0xff}
+		if i == transparent {
+			c.A = 0
+		}
+		p[i] = c
+	}
+	return p, nil
+}
+
+func writeACT(w io.Writer, p color.Palette) error {
+	if len(p) > 256 {
+		return fmt.Errorf("colorquant: an ACT palette can hold at most 256 colors, got %d", len(p))
+	}
+	data := make([]byte, 772)
+	transparent := 0xffff
+	for i, c := range p {
+		n := nrgba(c)
+		data[i*3], data[i*3+1], data[i*3+2] = n.R, n.G, n.B
+		if n.A == 0 && transparent == 0xffff {
+			transparent = i
+		}
+	}
+	binary.BigEndian.PutUint16(data[768:], uint16(len(p)))
+	binary.BigEndian.PutUint16(data[770:], uint16(transparent))
+	_, err := w.Write(data)
+	return err
+}
+
+// ACO color spaces.
+const (
+	acoRGB = 0
+	acoHSB = 1
+)
+
+func readACO(r io.Reader) (color.Palette, error) {
+	var hdr [2]uint16
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return nil, ErrPaletteFormat
+	}
+	version, count := hdr[0], int(hdr[1])
+	if version != 1 && version != 2 {
+		return nil, ErrPaletteFormat
+	}
+	// Version 1 is usually followed by a version 2 section holding the color names
+	// as well, but the colors of the first section are enough.
+	p := make(color.Palette, 0, count)
+	for i := 0; i < count; i++ {
+		var v [5]uint16
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return nil, ErrPaletteFormat
+		}
+		if version == 2 {
+			var n uint32
+			if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+				return nil, ErrPaletteFormat
+			}
+			if _, err := io.CopyN(ioutil.Discard, r, int64(n)*2); err != nil {
+				return nil, ErrPaletteFormat
+			}
+		}
+		switch v[0] {
+		case acoRGB:
+			p = append(p, color.NRGBA64{v[1], v[2], v[3], 0xffff})
+		case acoHSB:
+			p = append(p, hsb(float64(v[1])/65535*360, float64(v[2])/65535, float64(v[3])/65535))
+		default:
+			return nil, fmt.Errorf("colorquant: unsupported ACO color space %d", v[0])
+		}
+	}
+	return p, nil
+}
+
+func writeACO(w io.Writer, p color.Palette) error {
+	bw := bufio.NewWriter(w)
+	for version := uint16(1); version <= 2; version++ {
+		binary.Write(bw, binary.BigEndian, [2]uint16{version, uint16(len(p))})
+		for _, c := range p {
+			r, g, b, a := c.RGBA()
+			if a != 0 && a != 0xffff {
+				// Use non-premultiplied values.
+				r, g, b = r*0xffff/a, g*0xffff/a, b*0xffff/a
+			}
+			binary.Write(bw, binary.BigEndian, [5]uint16{acoRGB, uint16(r), uint16(g), uint16(b), 0})
+			if version == 2 {
+				name := utf16.Encode([]rune(colorName(nrgba(c)) + "\x00"))
+				binary.Write(bw, binary.BigEndian, uint32(len(name)))
+				binary.Write(bw, binary.BigEndian, name)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// hsb converts a hue, saturation, brightness triplet to an RGB color.
+func hsb(h, s, v float64) color.Color {
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	m := v - c
+	return color.NRGBA64{uint16((r + m) * 0xffff), uint16((g + m) * 0xffff), uint16((b + m) * 0xffff), 0xffff}
+}
+
+// ASE block types.
+const (
+	aseGroupStart = 0xc001
+	aseGroupEnd   = 0xc002
+	aseColor      = 0x0001
+)
+
+func readASE(r io.Reader) (color.Palette, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[:4]) != "ASEF" {
+		return nil, ErrPaletteFormat
+	}
+	n := int(binary.BigEndian.Uint32(data[8:]))
+	data = data[12:]
+
+	var p color.Palette
+	for i := 0; i < n; i++ {
+		if len(data) < 6 {
+			return nil, ErrPaletteFormat
+		}
+		typ := binary.BigEndian.Uint16(data)
+		size := int(binary.BigEndian.Uint32(data[2:]))
+		if len(data) < 6+size {
+			return nil, ErrPaletteFormat
+		}
+		block := data[6 : 6+size]
+		data = data[6+size:]
+		if typ != aseColor {
+			continue
+		}
+		// Skip the UTF-16 name, prefixed with its length in code units.
+		if len(block) < 2 {
+			return nil, ErrPaletteFormat
+		}
+		nameLen := int(binary.BigEndian.Uint16(block)) * 2
+		if len(block) < 2+nameLen+4 {
+			return nil, ErrPaletteFormat
+		}
+		block = block[2+nameLen:]
+		model := string(block[:4])
+		block = block[4:]
+
+		f := func(i int) float64 {
+			if len(block) < 4*(i+1) {
+				return 0
+			}
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(block[4*i:])))
+		}
+		switch model {
+		case "RGB ":
+			p = append(p, unitColor(f(0), f(1), f(2)))
+		case "Gray":
+			p = append(p, unitColor(f(0), f(0), f(0)))
+		case "CMYK":
+			k := 1 - f(3)
+			p = append(p, unitColor((1-f(0))*k, (1-f(1))*k, (1-f(2))*k))
+		default:
+			return nil, fmt.Errorf("colorquant: unsupported ASE color model %q", model)
+		}
+	}
+	return p, nil
+}
+
+func writeASE(w io.Writer, p color.Palette) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("ASEF")
+	binary.Write(bw, binary.BigEndian, [2]uint16{1, 0})
+	binary.Write(bw, binary.BigEndian, uint32(len(p)))
+	for _, c := range p {
+		n := nrgba(c)
+		name := utf16.Encode([]rune(colorName(n) + "\x00"))
+		binary.Write(bw, binary.BigEndian, uint16(aseColor))
+		binary.Write(bw, binary.BigEndian, uint32(2+len(name)*2+4+3*4+2))
+		binary.Write(bw, binary.BigEndian, uint16(len(name)))
+		binary.Write(bw, binary.BigEndian, name)
+		bw.WriteString("RGB ")
+		binary.Write(bw, binary.BigEndian, [3]float32{float32(n.R) / 255, float32(n.G) / 255, float32(n.B) / 255})
+		binary.Write(bw, binary.BigEndian, uint16(2)) // normal color
+	}
+	return bw.Flush()
+}
+
+// unitColor returns the color of R,G,B values in the [0, 1] interval.
+func unitColor(r, g, b float64) color.NRGBA {
+	u := func(v float64) uint8 {
+		return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+	}
+	return color.NRGBA{u(r), u(g), u(b), 0xff}
+}
+
+func readJASC(r io.Reader) (color.Palette, error) {
+	ls, err := lines(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(ls) < 3 || ls[0] != "JASC-PAL" {
+		return nil, ErrPaletteFormat
+	}
+	count, err := strconv.Atoi(ls[2])
+	if err != nil || count != len(ls)-3 {
+		return nil, ErrPaletteFormat
+	}
+	p := make(color.Palette, count)
+	for i, l := range ls[3:] {
+		c, err := parseRGB(l)
+		if err != nil {
+			return nil, err
+		}
+		p[i] = c
+	}
+	return p, nil
+}
+
+func writeJASC(w io.Writer, p color.Palette) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "JASC-PAL\r\n0100\r\n%d\r\n", len(p))
+	for _, c := range p {
+		n := nrgba(c)
+		fmt.Fprintf(bw, "%d %d %d\r\n", n.R, n.G, n.B)
+	}
+	return bw.Flush()
+}
+
+// parseHex parses a hexadecimal color of the given digits, in the order of the channels.
+func parseHex(s string, channels string) (color.NRGBA, error) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != len(channels)*2 {
+		return color.NRGBA{}, fmt.Errorf("colorquant: invalid color %q", s)
+	}
+	c := color.NRGBA{A: 0xff}
+	for i := range channels {
+		b := uint8(v >> uint(8*(len(channels)-1-i)))
+		switch channels[i] {
+		case 'r':
+			c.R = b
+		case 'g':
+			c.G = b
+		case 'b':
+			c.B = b
+		case 'a':
+			c.A = b
+		}
+	}
+	return c, nil
+}
+
+func readPaintNET(r io.Reader) (color.Palette, error) {
+	ls, err := lines(r)
+	if err != nil {
+		return nil, err
+	}
+	var p color.Palette
+	for _, l := range ls {
+		if strings.HasPrefix(l, ";") {
+			continue
+		}
+		c, err := parseHex(l, "argb")
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, c)
+	}
+	return p, nil
+}
+
+func writePaintNET(w io.Writer, p color.Palette) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; Paint.NET Palette File\r\n; Generated by colorquant\r\n")
+	for _, c := range p {
+		n := nrgba(c)
+		fmt.Fprintf(bw, "%02X%02X%02X%02X\r\n", n.A, n.R, n.G, n.B)
+	}
+	return bw.Flush()
+}
+
+func readHex(r io.Reader) (color.Palette, error) {
+	ls, err := lines(r)
+	if err != nil {
+		return nil, err
+	}
+	var p color.Palette
+	for _, l := range ls {
+		l = strings.TrimPrefix(l, "#")
+		channels := "rgb"
+		if len(l) == 8 {
+			channels = "rgba"
+		}
+		c, err := parseHex(l, channels)
+		if err != nil {
+			return nil, err
+		}
+		p = append(p, c)
+	}
+	return p, nil
+}
+
+func writeHex(w io.Writer, p color.Palette) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range p {
+		n := nrgba(c)
+		if n.A == 0xff {
+			fmt.Fprintf(bw, "#%02x%02x%02x\n", n.R, n.G, n.B)
+		} else {
+			fmt.Fprintf(bw, "#%02x%02x%02x%02x\n", n.R, n.G, n.B, n.A)
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,67 @@
+package colorquant
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestPaletteRoundTrip(t *testing.T) {
+	p := color.Palette{
+		color.NRGBA{0, 0, 0, 0xff},
+		color.NRGBA{0xff, 0xff, 0xff, 0xff},
+		color.NRGBA{0x12, 0x34, 0x56, 0xff},
+		color.NRGBA{0xfe, 0x80, 0x01, 0xff},
+	}
+	formats := map[string]PaletteFormat{
+		"GPL": GPL, "ACT": ACT, "ACO": ACO, "ASE": ASE, "JASC": JASC, "PaintNET": PaintNET, "Hex": Hex,
+	}
+	for name, format := range formats {
+		var buf bytes.Buffer
+		if err := WritePalette(&buf, p, format); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		res, err := ReadPalette(&buf, format)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(res) != len(p) {
+			t.Fatalf("%s: expected %d colors, got %d", name, len(p), len(res))
+		}
+		for i := range p {
+			if nrgba(res[i]) != p[i] {
+				t.Errorf("%s: expected color %v, got %v", name, p[i], nrgba(res[i]))
+			}
+		}
+	}
+}
+
+func TestPaletteTransparency(t *testing.T) {
+	p := color.Palette{color.NRGBA{0xff, 0, 0, 0xff}, color.NRGBA{0, 0, 0, 0}}
+	for _, format := range []PaletteFormat{ACT, PaintNET, Hex} {
+		var buf bytes.Buffer
+		WritePalette(&buf, p, format)
+		res, err := ReadPalette(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, a := res[1].RGBA(); a != 0 {
+			t.Errorf("The transparent color should be preserved by format %d", format)
+		}
+	}
+}
+
+func TestReadPalette(t *testing.T) {
+	gpl := "GIMP Palette\nName: Test\nColumns: 2\n#\n255   0   0\tRed\n  0 255   0\tGreen\n"
+	p, err := ReadPalette(strings.NewReader(gpl), GPL)
+	if err != nil || len(p) != 2 || nrgba(p[1]) != (color.NRGBA{0, 0xff, 0, 0xff}) {
+		t.Errorf("Unexpected GPL palette %v (%v)", p, err)
+	}
+	if _, err := ReadPalette(strings.NewReader("not a palette"), JASC); err != ErrPaletteFormat {
+		t.Errorf("Expected %v, got %v", ErrPaletteFormat, err)
+	}
+	if f, ok := FormatByExt("swatches.ASE"); !ok || f != ASE {
+		t.Error("The .ase extension should be recognized")
+	}
+}
@@ -0,0 +1,130 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// PatternDither implements Thomas Knoll's pattern dithering algorithm.
+// Instead of diffusing the quantization error to the neighbouring pixels,
+// for every pixel it builds a mixing plan of candidate palette colors which
+// together approximate the source color, and picks one of them through an
+// ordered (Bayer) threshold matrix. This gives stable, noise free results on
+// arbitrary fixed palettes like palette.WebSafe or palette.Plan9.
+type PatternDither struct {
+	// Size is the dimension of the Bayer threshold matrix. It must be a power of two,
+	// the number of candidate colors in a mixing plan is Size*Size. Defaults to 4.
+	Size int
+	// Threshold is the error multiplier used when building the mixing plan.
+	// Lower values give a softer, less contrasted pattern. Defaults to 0.5.
+	Threshold float64
+}
+
+// Quantize maps the source image onto the palette of the destination image using pattern dithering.
+// If useQuantizer is true the palette is generated by the median cut quantizer with nq colors,
+// otherwise dst must be an *image.Paletted and its palette will be used.
+func (pd PatternDither) Quantize(src image.Image, dst draw.Image, nq int, useDither bool, useQuantizer bool) image.Image {
+	var pal color.Palette
+	if useQuantizer {
+		pal = paletteOf(Quant{}.Quantize(src, nq))
+	} else if p, ok := dst.(*image.Paletted); ok {
+		pal = p.Palette
+	}
+	if len(pal) == 0 {
+		return dst
+	}
+	size := pd.Size
+	if size < 2 || size&(size-1) != 0 {
+		size = 4
+	}
+	threshold := pd.Threshold
+	if threshold <= 0 {
+		threshold = 0.5
+	}
+	matrix := bayer(size)
+
+	palette := paletteValues(pal)
+	tree := newKDTree(palette, rgbaWeights)
+	luma := make([]int32, len(pal))
+	for i, p := range palette {
+		luma[i] = (299*p[0] + 587*p[1] + 114*p[2]) / 1000
+	}
+
+	// Indices can be written directly only when the destination palette is the one we are mapping to.
+	var pix *image.Paletted
+	if p, ok := dst.(*image.Paletted); ok && !useQuantizer {
+		pix = p
+	}
+
+	plan := make([]int, size*size)
+	b, db := src.Bounds(), dst.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := src.At(x, y).RGBA()
+			var idx int
+			if useDither {
+				mixingPlan(plan, tree, palette, luma, int32(r), int32(g), int32(bl), int32(a), threshold)
+				idx = plan[matrix[(y-b.Min.Y)%size][(x-b.Min.X)%size]]
+			} else {
+				idx = tree.nearest(int32(r), int32(g), int32(bl), int32(a))
+			}
+			dx, dy := x-b.Min.X+db.Min.X, y-b.Min.Y+db.Min.Y
+			if pix != nil {
+				pix.SetColorIndex(dx, dy, uint8(idx))
+			} else {
+				dst.Set(dx, dy, pal[idx])
+			}
+		}
+	}
+	return dst
+}
+
+// mixingPlan fills the plan with palette indices whose average approximates the source color.
+// The candidates are sorted by luminance, so that the threshold matrix picks the darker
+// candidates on its lower and the lighter ones on its higher values.
+func mixingPlan(plan []int, tree *kdTree, palette [][4]int32, luma []int32, r, g, b, a int32, threshold float64) {
+	var er, eg, eb int32
+	for i := range plan {
+		tr := clamp(r + int32(float64(er)*threshold))
+		tg := clamp(g + int32(float64(eg)*threshold))
+		tb := clamp(b + int32(float64(eb)*threshold))
+		idx := tree.nearest(tr, tg, tb, a)
+		plan[i] = idx
+		// Accumulate the error between the source color and the chosen candidate.
+		er += r - palette[idx][0]
+		eg += g - palette[idx][1]
+		eb += b - palette[idx][2]
+	}
+	// Break the ties by palette index, so that the order doesn't depend on the sort algorithm.
+	sort.Slice(plan, func(i, j int) bool {
+		if luma[plan[i]] == luma[plan[j]] {
+			return plan[i] < plan[j]
+		}
+		return luma[plan[i]] < luma[plan[j]]
+	})
+}
+
+// bayer returns the n x n Bayer threshold matrix with values in the [0, n*n) interval.
+// n must be a power of two.
+func bayer(n int) [][]int {
+	m := [][]int{{0}}
+	for size := 1; size < n; size *= 2 {
+		next := make([][]int, size*2)
+		for y := range next {
+			next[y] = make([]int, size*2)
+		}
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				v := 4 * m[y][x]
+				next[y][x] = v
+				next[y][x+size] = v + 2
+				next[y+size][x] = v + 3
+				next[y+size][x+size] = v + 1
+			}
+		}
+		m = next
+	}
+	return m
+}
@@ -0,0 +1,60 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestPatternDither_MixesPaletteColors(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 8, 8))
+	for i := range src.Pix {
+		src.Pix[i] = 0x80
+	}
+	bw := color.Palette{color.Black, color.White}
+	dst := image.NewPaletted(src.Bounds(), bw)
+	PatternDither{}.Quantize(src, dst, 2, true, false)
+
+	var black, white int
+	for _, idx := range dst.Pix {
+		if idx == 0 {
+			black++
+		} else {
+			white++
+		}
+	}
+	if black == 0 || white == 0 {
+		t.Fatalf("Expected a mix of black and white pixels, got %d black and %d white", black, white)
+	}
+	if d := black - white; d < -8 || d > 8 {
+		t.Errorf("Mid gray should be dithered to roughly the same number of black and white pixels, got %d black and %d white", black, white)
+	}
+}
+
+func TestPatternDither_NoDither(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 4, 4))
+	for i := range src.Pix {
+		src.Pix[i] = 0x20
+	}
+	dst := image.NewPaletted(src.Bounds(), color.Palette{color.White, color.Black})
+	PatternDither{}.Quantize(src, dst, 2, false, false)
+
+	for _, idx := range dst.Pix {
+		if idx != 1 {
+			t.Fatalf("Dark pixels should be mapped to black, got palette index %d", idx)
+		}
+	}
+}
+
+func TestBayer(t *testing.T) {
+	m := bayer(4)
+	seen := make(map[int]bool)
+	for _, row := range m {
+		for _, v := range row {
+			seen[v] = true
+		}
+	}
+	if len(m) != 4 || len(seen) != 16 {
+		t.Errorf("The 4x4 Bayer matrix should contain 16 distinct values, got %d", len(seen))
+	}
+}
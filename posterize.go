@@ -0,0 +1,138 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Posterize is a quantizer which gives each channel a fixed number of evenly spaced levels,
+// for example 6×7×6 levels, or 8×8×4 levels for the 3-3-2 bit RGB format. The pixels are mapped
+// to the levels directly, without searching a palette. It can be combined with any error
+// diffusion kernel, or with ordered (Bayer) dithering.
+type Posterize struct {
+	// Levels is the number of levels of the R, G and B channels, between 2 and 256.
+	Levels [3]int
+	// Dither is the error diffusion kernel applied when dithering is requested.
+	Dither Dither
+	// Ordered is the size of the Bayer matrix used for ordered dithering, a power of two.
+	// If set, it's used instead of the error diffusion kernel.
+	Ordered int
+}
+
+// PosterizeBits returns a posterizer with the given number of bits per channel, like 3, 3, 2.
+func PosterizeBits(r, g, b int) Posterize {
+	return Posterize{Levels: [3]int{1 << uint(r), 1 << uint(g), 1 << uint(b)}}
+}
+
+func (p Posterize) levels() [3]int {
+	levels := p.Levels
+	for i, n := range levels {
+		switch {
+		case n < 2:
+			levels[i] = 2
+		case n > 256:
+			levels[i] = 256
+		}
+	}
+	return levels
+}
+
+// Palette returns the colors of the posterizer. The color of the levels (r, g, b)
+// is at index (r*Levels[1]+g)*Levels[2]+b.
+func (p Posterize) Palette() color.Palette {
+	n := p.levels()
+	pal := make(color.Palette, 0, n[0]*n[1]*n[2])
+	for r := 0; r < n[0]; r++ {
+		for g := 0; g < n[1]; g++ {
+			for b := 0; b < n[2]; b++ {
+				pal = append(pal, color.RGBA{level(r, n[0]), level(g, n[1]), level(b, n[2]), 0xff})
+			}
+		}
+	}
+	return pal
+}
+
+// level returns the 8 bit value of the k-th of n evenly spaced levels.
+func level(k, n int) uint8 {
+	return uint8((k*255 + (n-1)/2) / (n - 1))
+}
+
+// Quantize posterizes the source image into the destination image, with dithering if useDither is set.
+// The nq and useQuantizer parameters are ignored. If dst is an *image.Paletted with the palette of
+// the posterizer, the indices are written directly, otherwise the colors are set.
+func (p Posterize) Quantize(src image.Image, dst draw.Image, nq int, useDither bool, useQuantizer bool) image.Image {
+	n := p.levels()
+	db := dst.Bounds()
+
+	var pix *image.Paletted
+	if pd, ok := dst.(*image.Paletted); ok && len(pd.Palette) <= 256 && isPosterized(pd.Palette, n) {
+		pix = pd
+	}
+	set := func(x, y int, k [3]int) {
+		x, y = db.Min.X+x, db.Min.Y+y
+		if pix != nil {
+			pix.SetColorIndex(x, y, uint8((k[0]*n[1]+k[1])*n[2]+k[2]))
+			return
+		}
+		dst.Set(x, y, color.RGBA{level(k[0], n[0]), level(k[1], n[1]), level(k[2], n[2]), 0xff})
+	}
+
+	if useDither && p.Ordered > 0 {
+		p.ordered(src, n, set)
+		return dst
+	}
+	p.Dither.diffuse(src, useDither, func(x, y int, r, g, b, a int32) (int32, int32, int32) {
+		var k [3]int
+		var out [3]int32
+		for i, v := range [3]int32{r, g, b} {
+			k[i] = int((int64(v)*int64(n[i]-1) + 0x7fff) / 0xffff)
+			out[i] = int32(level(k[i], n[i])) * 0x101
+		}
+		set(x, y, k)
+		return out[0], out[1], out[2]
+	})
+	return dst
+}
+
+// ordered posterizes the image with ordered dithering: the threshold of the Bayer matrix
+// decides whether a channel value is rounded down or up to a neighbouring level.
+func (p Posterize) ordered(src image.Image, n [3]int, set func(x, y int, k [3]int)) {
+	size := p.Ordered
+	if size < 2 || size&(size-1) != 0 {
+		size = 4
+	}
+	matrix := bayer(size)
+	b := src.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			r, g, bl, _ := src.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			t := (float64(matrix[y%size][x%size]) + 0.5) / float64(size*size)
+			var k [3]int
+			for i, v := range [3]uint32{r, g, bl} {
+				k[i] = int(float64(v)*float64(n[i]-1)/0xffff + t)
+				if k[i] > n[i]-1 {
+					k[i] = n[i] - 1
+				}
+			}
+			set(x, y, k)
+		}
+	}
+}
+
+// isPosterized reports whether the palette holds the colors of the levels in the order of Posterize.Palette.
+// The level counts are checked against the palette length first, so the colors are compared only if they fit.
+func isPosterized(pal color.Palette, n [3]int) bool {
+	if len(pal) != n[0]*n[1]*n[2] {
+		return false
+	}
+	for i, c := range pal {
+		r, g, b, a := c.RGBA()
+		k := [3]int{i / (n[1] * n[2]), i / n[2] % n[1], i % n[2]}
+		if r != uint32(level(k[0], n[0]))*0x101 || g != uint32(level(k[1], n[1]))*0x101 ||
+			b != uint32(level(k[2], n[2]))*0x101 || a != 0xffff {
+			return false
+		}
+	}
+	return true
+}
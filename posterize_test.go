@@ -0,0 +1,89 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestPosterize_Palette(t *testing.T) {
+	if n := len(Posterize{Levels: [3]int{6, 7, 6}}.Palette()); n != 252 {
+		t.Errorf("Expected 252 colors, got %d", n)
+	}
+	p := PosterizeBits(3, 3, 2).Palette()
+	if len(p) != 256 {
+		t.Fatalf("Expected 256 colors, got %d", len(p))
+	}
+	if !sameColor(p[0], color.Black) || !sameColor(p[255], color.White) {
+		t.Errorf("Expected the palette to range from black to white, got %v and %v", p[0], p[255])
+	}
+	if want := (color.RGBA{0x24, 0, 0x55, 0xff}); !sameColor(p[(1*8+0)*4+1], want) {
+		t.Errorf("Expected the color %v, got %v", want, p[(1*8+0)*4+1])
+	}
+}
+
+func TestPosterize_Quantize(t *testing.T) {
+	img := gradient(32, 32)
+	post := Posterize{Levels: [3]int{4, 4, 4}}
+	rgba := image.NewRGBA(img.Bounds())
+	post.Quantize(img, rgba, 0, false, false)
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			if v := rgba.Pix[i+c]; v%0x55 != 0 {
+				t.Fatalf("Expected only the values of 4 levels, got %d", v)
+			}
+			if d := math.Abs(float64(rgba.Pix[i+c]) - float64(img.Pix[i+c])); d > 0x55/2+1 {
+				t.Fatalf("The value %d should be mapped to the nearest level, got %d", img.Pix[i+c], rgba.Pix[i+c])
+			}
+		}
+	}
+	// A paletted destination with the posterizer's palette gets the same colors.
+	pal := image.NewPaletted(img.Bounds(), post.Palette())
+	post.Quantize(img, pal, 0, false, false)
+	if !samePixels(rgba, pal) {
+		t.Error("The paletted and the RGBA results should match")
+	}
+	// A palette of the same size in another order gets the colors set, not the indices.
+	rev := post.Palette()
+	for i, j := 0, len(rev)-1; i < j; i, j = i+1, j-1 {
+		rev[i], rev[j] = rev[j], rev[i]
+	}
+	if isPosterized(rev, post.levels()) || !isPosterized(post.Palette(), post.levels()) {
+		t.Error("Only the palette of the posterizer should be recognized")
+	}
+	pal = image.NewPaletted(img.Bounds(), rev)
+	post.Quantize(img, pal, 0, false, false)
+	if !samePixels(rgba, pal) {
+		t.Error("The result in a reversed palette should match the RGBA result")
+	}
+}
+
+func TestPosterize_Dither(t *testing.T) {
+	// A flat mid gray is reproduced on average from black and white by both dithering modes.
+	img := image.NewGray(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	fs := Dither{Filter: [][]float32{
+		{0, 0, 7.0 / 16},
+		{3.0 / 16, 5.0 / 16, 1.0 / 16},
+	}}
+	for _, post := range []Posterize{
+		{Levels: [3]int{2, 2, 2}, Dither: fs},
+		{Levels: [3]int{2, 2, 2}, Ordered: 4},
+	} {
+		dst := image.NewPaletted(img.Bounds(), post.Palette())
+		post.Quantize(img, dst, 0, true, false)
+		var sum float64
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				r, _, _, _ := dst.At(x, y).RGBA()
+				sum += float64(r >> 8)
+			}
+		}
+		if mean := sum / (32 * 32); math.Abs(mean-0x80) > 8 {
+			t.Errorf("Expected the mean value close to %d, got %f (ordered: %d)", 0x80, mean, post.Ordered)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package colorquant
+
+// SplitPriority is the rule for picking the next cluster to split during the median cut.
+type SplitPriority int
+
+const (
+	// ByPopulation splits the cluster with the most pixels (or the greatest total weight).
+	ByPopulation SplitPriority = iota
+	// ByVolume splits the cluster with the largest bounding box in the color space.
+	ByVolume
+	// ByVariance splits the cluster with the largest sum of squared color deviations.
+	ByVariance
+	// ByPopulationVolume splits by population for the first half of the clusters, and by
+	// population multiplied by volume for the second half, as done by Leptonica's modified median cut.
+	// This prevents starving the rare but saturated colors.
+	ByPopulationVolume
+)
+
+// priority returns the split priority of a cluster according to the rule of the work space.
+func (qz *Quant) priority(c *cluster) float64 {
+	if c.axis != ([3]float64{}) {
+		return c.axisVar
+	}
+	switch qz.Priority {
+	case ByVolume:
+		return c.volume
+	case ByVariance:
+		return qz.variance(c)
+	case ByPopulationVolume:
+		if qz.phase > 0 {
+			return c.weight * c.volume
+		}
+	}
+	return c.weight
+}
+
+// variance returns the weighted sum of squared deviations of the cluster colors from their mean, in 8 bit units.
+func (qz *Quant) variance(c *cluster) float64 {
+	var sw float64
+	var s, ss [3]float64
+	for _, p := range c.px {
+		w := qz.weight(p)
+		r, g, b, _ := qz.img.At(p.x, p.y).RGBA()
+		for i, v := range [3]float64{float64(r) / 0x101, float64(g) / 0x101, float64(b) / 0x101} {
+			s[i] += w * v
+			ss[i] += w * v * v
+		}
+		sw += w
+	}
+	return sse(sw, s, ss)
+}
+
+// sse returns the sum of squared deviations from the mean, given the total weight,
+// and the weighted sums and sums of squares of the R,G,B values.
+func sse(w float64, s, ss [3]float64) float64 {
+	if w == 0 {
+		return 0
+	}
+	var sum float64
+	for i := range s {
+		sum += ss[i] - s[i]*s[i]/w
+	}
+	return sum
+}
@@ -0,0 +1,51 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQuant_Priority(t *testing.T) {
+	// A large gray gradient with a few saturated green pixels.
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(x * 4)
+			img.Set(x, y, color.RGBA{v, v, v, 0xff})
+		}
+	}
+	for x := 0; x < 8; x++ {
+		img.Set(x, 0, color.RGBA{0, 0xff, 0, 0xff})
+	}
+	hasGreen := func(p color.Palette) bool {
+		for _, c := range p {
+			if r, g, _, _ := c.RGBA(); g > 0xc000 && r < 0x4000 {
+				return true
+			}
+		}
+		return false
+	}
+	for _, priority := range []SplitPriority{ByVolume, ByVariance, ByPopulationVolume} {
+		p := Quant{Priority: priority}.Quantize(img, 16).(*image.Paletted)
+		if !hasGreen(p.Palette) {
+			t.Errorf("The split priority %d should preserve the rare saturated color", priority)
+		}
+		if len(p.Palette) != 16 {
+			t.Errorf("Expected 16 colors, got %d", len(p.Palette))
+		}
+	}
+	if p := (Quant{}).Quantize(img, 16).(*image.Paletted); hasGreen(p.Palette) {
+		t.Error("The population rule is expected to spend the palette on the gradient")
+	}
+}
+
+func TestQuant_Variance(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 1))
+	img.Pix[0], img.Pix[1] = 0, 10
+	qz := newQuantizer(img, 1)
+	// Each channel deviates by 5 from the mean of 5.
+	if v := qz.variance(&qz.cs[0]); v < 149.99 || v > 150.01 {
+		t.Errorf("Expected a variance of 150, got %f", v)
+	}
+}
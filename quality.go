@@ -0,0 +1,129 @@
+package colorquant
+
+import "image"
+
+// QualityMetric selects the metric of the quality target used by QuantizeToQuality.
+type QualityMetric int
+
+const (
+	// MinPSNR requires the PSNR of the result to be at least the target value, in dB.
+	MinPSNR QualityMetric = iota
+	// MaxMeanDeltaE requires the average CIEDE2000 ΔE of the result to be at most the target value.
+	MaxMeanDeltaE
+)
+
+// QuantizeToQuality finds the smallest palette, of at most maxColors colors, which satisfies
+// the quality target. It returns the paletted image, the chosen number of colors and the achieved score.
+// The image type follows maxColors, like the result of Quantize.
+// If the target cannot be reached, the image with maxColors colors is returned.
+//
+// The median cut runs only once: since it splits the clusters one by one, the palettes of every
+// smaller size are obtained by merging back the clusters split off after the given step.
+// The ByPopulationVolume priority switches rules at a step depending on the number of colors,
+// so with it every palette size is quantized on its own. The search assumes that the quality
+// improves with the number of colors.
+func (q Quant) QuantizeToQuality(img image.Image, metric QualityMetric, target float64, maxColors int) (image.Image, int, float64) {
+	qz := q.workspace(img, maxColors)
+	qz.split()
+
+	type result struct {
+		img   image.Image
+		score float64
+	}
+	results := make(map[int]result)
+	eval := func(k int) result {
+		if r, ok := results[k]; ok {
+			return r
+		}
+		pz := qz
+		if q.Priority == ByPopulationVolume {
+			pz = q.workspace(img, len(q.Fixed)+k)
+			pz.cluster()
+		} else {
+			pz = qz.prefix(k)
+		}
+		res := pz.result(maxColors)
+		var score float64
+		switch metric {
+		case MinPSNR:
+			score, _ = PSNR(img, res)
+		case MaxMeanDeltaE:
+			score, _, _ = DeltaE(img, res)
+		}
+		results[k] = result{res, score}
+		return results[k]
+	}
+	satisfied := func(score float64) bool {
+		if metric == MaxMeanDeltaE {
+			return score <= target
+		}
+		return score >= target
+	}
+
+	// Binary search for the smallest number of clusters satisfying the target.
+	lo, hi := 1, len(qz.cs)
+	if hi == 0 || !satisfied(eval(hi).score) {
+		r := eval(hi)
+		return r.img, len(paletteOf(r.img)), r.score
+	}
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if satisfied(eval(mid).score) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	r := eval(hi)
+	return r.img, len(paletteOf(r.img)), r.score
+}
+
+// prefix returns a work space holding the first k clusters produced by the median cut.
+// The clusters split off later are merged back into the clusters they originate from.
+func (qz *Quant) prefix(k int) *Quant {
+	if k > len(qz.cs) {
+		k = len(qz.cs)
+	}
+	// Find the cluster among the first k each cluster has been split from.
+	root := make([]int, len(qz.cs))
+	sizes := make([]int, k)
+	for i := range qz.cs {
+		root[i] = i
+		if i >= k {
+			root[i] = root[qz.pt[i]]
+		}
+		sizes[root[i]] += len(qz.cs[i].px)
+	}
+	pz := &Quant{
+		Fixed:          qz.Fixed,
+		FixedTolerance: qz.FixedTolerance,
+		Weights:        qz.Weights,
+		Priority:       qz.Priority,
+		Cut:            qz.Cut,
+		PrincipalAxis:  qz.PrincipalAxis,
+		Order:          qz.Order,
+		img:            qz.img,
+		cs:             make([]cluster, k),
+		at:             qz.at,
+		wt:             qz.wt,
+	}
+	px := make([]point, len(qz.ch))
+	offset := 0
+	for i := 0; i < k; i++ {
+		pz.cs[i].px = px[offset : offset : offset+sizes[i]]
+		offset += sizes[i]
+	}
+	for i := range qz.cs {
+		c := &pz.cs[root[i]]
+		c.px = append(c.px, qz.cs[i].px...)
+	}
+	// The fixed colors are assigned again, as the pixels moved to them depend on the clusters.
+	if len(qz.Fixed) > 0 {
+		pz.fx = make([][]point, len(qz.fx))
+		for i := range qz.fx {
+			pz.fx[i] = append([]point(nil), qz.fx[i]...)
+		}
+		pz.lockFixed()
+	}
+	return pz
+}
@@ -0,0 +1,79 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 256 / w), uint8(y * 256 / h), 0x80, 0xff})
+		}
+	}
+	return img
+}
+
+func TestQuant_QuantizeToQuality(t *testing.T) {
+	img := gradient(64, 64)
+	res, n, score := Quant{}.QuantizeToQuality(img, MinPSNR, 30, 256)
+	if score < 30 {
+		t.Errorf("The PSNR should be at least 30 dB, got %.2f", score)
+	}
+	if p := res.(*image.Paletted); len(p.Palette) != n {
+		t.Errorf("The palette should have %d colors, got %d", n, len(p.Palette))
+	}
+	// The score should be the same as quantizing directly with the chosen number of colors.
+	direct, _ := PSNR(img, Quant{}.Quantize(img, n))
+	if direct != score {
+		t.Errorf("Expected the score %.4f of the direct quantization, got %.4f", direct, score)
+	}
+	// One color less should not reach the target.
+	if prev, _ := PSNR(img, Quant{}.Quantize(img, n-1)); prev >= 30 {
+		t.Errorf("%d colors should be the smallest palette reaching the target, but %d colors give %.2f dB", n, n-1, prev)
+	}
+}
+
+func TestQuant_QuantizeToQualityDeltaE(t *testing.T) {
+	img := gradient(32, 32)
+	_, n, score := Quant{}.QuantizeToQuality(img, MaxMeanDeltaE, 2, 256)
+	if score > 2 || n < 2 {
+		t.Errorf("Expected an average ΔE of at most 2, got %.2f with %d colors", score, n)
+	}
+	// An unreachable target returns the largest palette.
+	_, n, _ = Quant{}.QuantizeToQuality(img, MinPSNR, 200, 16)
+	if n != 16 {
+		t.Errorf("Expected the maximum number of colors, got %d", n)
+	}
+}
+
+func TestQuant_QuantizeToQualityPopulationVolume(t *testing.T) {
+	// The priority switches rules halfway through the requested colors,
+	// so the palettes can't be derived from a single larger run.
+	img := noisy(5, 64, 64)
+	q := Quant{Priority: ByPopulationVolume}
+	_, n, score := q.QuantizeToQuality(img, MinPSNR, 22, 128)
+	direct, _ := PSNR(img, q.Quantize(img, n))
+	if direct != score || direct < 22 {
+		t.Errorf("Expected the score %.4f of the direct quantization to %d colors to reach 22 dB, got %.4f", direct, n, score)
+	}
+}
+
+func TestQuant_QuantizeToQualityFixed(t *testing.T) {
+	// Dark and light pixels near the fixed black and white: the single cluster averaging
+	// them is farther from every pixel than the fixed colors, so it's dropped.
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = 0x10
+		if i%2 == 0 {
+			img.Pix[i] = 0xf0
+		}
+	}
+	q := Quant{Fixed: color.Palette{color.Black, color.White}}
+	res, n, _ := q.QuantizeToQuality(img, MinPSNR, 200, 3)
+	if p := res.(*image.Paletted); len(p.Palette) != n || n != 2 {
+		t.Errorf("Expected the 2 colors of the palette, got %d colors and a palette of %d", n, len(p.Palette))
+	}
+}
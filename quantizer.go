@@ -2,11 +2,11 @@ package colorquant
 
 import (
 	"container/heap"
+	"errors"
 	"image"
 	"image/color"
 	"image/draw"
 	"math"
-	"sort"
 )
 
 // Interface which implements the Quantize method.
@@ -15,26 +15,77 @@ type Quantizer interface {
 }
 
 // Image quantization method. Returns a paletted image.
-// We need to use type assertion to match the interface returning type.
+// We need to use type assertion to match the interface returning type: the result is an
+// *image.Paletted if the requested palette, nq or the fixed colors if there are more of them,
+// fits in 256 colors, otherwise a *Paletted16, however many colors the image actually produces. An nq above MaxColors is silently
+// clamped to MaxColors; QuantizePaletted and Quantize16 return typed results and report
+// the sizes which don't fit as errors.
 func (q Quant) Quantize(img image.Image, nq int) image.Image {
-	qz := newQuantizer(img, nq) 		// set up a work space
-	qz.cluster()				// cluster pixels by color
-	return qz.Paletted().(image.Image)	// generate paletted image from clusters
+	if nq > MaxColors {
+		nq = MaxColors
+	}
+	qz := q.workspace(img, nq) // set up a work space
+	qz.cluster()               // cluster pixels by color
+	return qz.result(nq)       // generate paletted image from clusters
 }
 
 // A workspace with members that can be accessed by methods.
+// The exported fields are the quantization options.
+//
+// The quantization is deterministic: the same image and options always produce the same palette,
+// in the same order, and the same pixel indices. The work space holds no shared state,
+// so a Quant value can be used from several goroutines at once.
 type Quant struct {
-	img image.Image // original image
-	cs  []cluster   // len is the desired number of colors
-	px  []point     // list of all points in the image
-	ch  chValues    // buffer for computing median
-	eq  []point     // additional buffer used when splitting cluster
+	// Fixed colors always occupy the first palette slots and are preserved exactly.
+	// The median cut spends only the remaining slots on the image content.
+	Fixed color.Palette
+	// FixedTolerance is the maximum Euclidean distance, in 8 bit R,G,B,A units, of the pixels
+	// assigned to a fixed color before clustering. Zero means only exact matches are assigned.
+	// After clustering, every pixel closer to a fixed color than to its cluster is mapped to it.
+	FixedTolerance float64
+	// Weights is an optional importance map of the same size as the image. Pixels with higher
+	// values count more when choosing the cluster to split and when averaging the cluster colors,
+	// so that salient regions (faces, products) get more palette entries than the background.
+	// With SharedPalette the map applies to each of the images, combined with the image weights.
+	// A map of another size makes QuantizePaletted and Quantize16 return ErrWeights,
+	// the methods without an error result panic with it.
+	Weights *image.Gray
+	// Priority is the rule for picking the next cluster to split. Defaults to ByPopulation.
+	Priority SplitPriority
+	// Cut is the position the clusters are split at along their widest channel,
+	// or along their principal axis if PrincipalAxis is set. Defaults to CutMedian.
+	Cut CutMethod
+	// PrincipalAxis splits the clusters perpendicular to the principal axis of their colors,
+	// instead of along the widest R, G or B channel. The variance along the axis is used as split
+	// priority in place of Priority. It helps clusters elongated diagonally in the color space.
+	PrincipalAxis bool
+	// Order is the order of the colors in the palette, the fixed colors always come first.
+	// Defaults to OrderCreation.
+	Order PaletteOrder
+
+	img   image.Image // original image
+	cs    []cluster   // len is the desired number of colors
+	px    []point     // list of all points in the image
+	ch    chValues    // buffer for computing median
+	eq    []point     // additional buffer used when splitting cluster
+	fx    [][]point   // points mapped to the fixed colors
+	at    *atlas      // set if the image is an atlas of several images
+	wt    []float64   // weight of the pixels of each atlas image, nil if unweighted
+	pt    []int       // index of the cluster each cluster was split from
+	phase int         // phase of the two phase split priorities
 }
 
 type cluster struct {
-	px       []point // list of points in the cluster
-	widestCh int     // rx, gx, bx const for channel with widest value range
-	chRange  uint32  // value range (vmax-vmin) of widest channel
+	px       []point    // list of points in the cluster
+	widestCh int        // rx, gx, bx const for channel with widest value range
+	chRange  uint32     // value range (vmax-vmin) of widest channel
+	chMin    uint32     // minimum value of widest channel
+	axis     [3]float64 // principal axis of the colors, zero if split along the widest channel
+	axisVar  float64    // sum of weighted squared deviations along the principal axis
+	weight   float64    // total weight of the points in the cluster
+	volume   float64    // volume of the cluster's bounding box in 8 bit R,G,B units
+	priority float64    // splitting priority, the cluster with the highest priority is split first
+	index    int        // index of the cluster in the work space
 }
 
 type point struct{ x, y int }
@@ -48,36 +99,110 @@ const (
 )
 
 func newQuantizer(img image.Image, nq int) *Quant {
-	b := img.Bounds()
-	npx := (b.Max.X - b.Min.X) * (b.Max.Y - b.Min.Y)
+	// An atlas may contain gaps, only the rectangles of its images hold pixels.
+	rects := []image.Rectangle{img.Bounds()}
+	at, _ := img.(*atlas)
+	if at != nil {
+		rects = at.rects()
+	}
+	npx := 0
+	for _, b := range rects {
+		npx += (b.Max.X - b.Min.X) * (b.Max.Y - b.Min.Y)
+	}
 	// Create work space.
 	qz := &Quant{
 		img: img,
 		ch:  make(chValues, npx),
 		cs:  make([]cluster, nq),
+		at:  at,
 	}
 	// Populate initial cluster with all pixels from image.
 	c := &qz.cs[0]
 	px := make([]point, npx)
 	c.px = px
 	i := 0
-	for y := b.Min.Y; y < b.Max.Y; y++ {
-		for x := b.Min.X; x < b.Max.X; x++ {
-			px[i].x = x
-			px[i].y = y
-			i++
+	for _, b := range rects {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				px[i].x = x
+				px[i].y = y
+				i++
+			}
 		}
 	}
 	return qz
 }
 
+// ErrWeights is returned when the weight map doesn't have the size of the image.
+var ErrWeights = errors.New("colorquant: the weight map should have the size of the image")
+
+// checkWeights returns ErrWeights if the weight map doesn't have the size of the image,
+// or of every image of an atlas.
+func (q Quant) checkWeights(img image.Image) error {
+	if q.Weights == nil {
+		return nil
+	}
+	imgs := []image.Image{img}
+	if at, ok := img.(*atlas); ok {
+		imgs = at.imgs
+	}
+	for _, img := range imgs {
+		if img.Bounds().Size() != q.Weights.Bounds().Size() {
+			return ErrWeights
+		}
+	}
+	return nil
+}
+
+// workspace sets up a work space with the options of q for quantizing img to nq colors.
+// It panics with ErrWeights if the weight map doesn't match the image.
+func (q Quant) workspace(img image.Image, nq int) *Quant {
+	if err := q.checkWeights(img); err != nil {
+		panic(err)
+	}
+	n := nq - len(q.Fixed)
+	if n < 1 {
+		n = 1
+	}
+	qz := newQuantizer(img, n)
+	if qz.at != nil {
+		qz.wt = qz.at.weights
+	}
+	qz.Weights = q.Weights
+	qz.Priority = q.Priority
+	qz.Cut = q.Cut
+	qz.PrincipalAxis = q.PrincipalAxis
+	qz.Order = q.Order
+	qz.Fixed = q.Fixed
+	qz.FixedTolerance = q.FixedTolerance
+	if len(q.Fixed) > 0 {
+		qz.assignFixed(nq-len(q.Fixed) < 1)
+	}
+	return qz
+}
+
 func (qz *Quant) cluster() {
+	qz.split()
+	// Move the pixels closer to a fixed color than to their cluster.
+	if len(qz.Fixed) > 0 {
+		qz.lockFixed()
+	}
+}
+
+// split runs the median cut, recording the cluster each new cluster has been split from.
+func (qz *Quant) split() {
+	if len(qz.cs) == 0 {
+		return
+	}
+	qz.pt = make([]int, len(qz.cs))
 	// Cluster by repeatedly splitting clusters.
 	// Use a heap as priority queue for picking clusters to split.
-	// The rule will be to split the cluster with the most pixels.
+	// The rule is defined by the split priority, by default it's
+	// to split the cluster with the most pixels.
 	// Terminate when the desired number of clusters has been populated
 	// or when clusters cannot be further split.
 	pq := new(queue)
+	qz.phase = 0
 	// Initial cluster.  populated at this point, but not analyzed.
 	c := &qz.cs[0]
 	for i := 1; ; {
@@ -87,16 +212,26 @@ func (qz *Quant) cluster() {
 		if c.chRange > 0 {
 			heap.Push(pq, c) // add new cluster to queue
 		}
-		// If no clusters have any color variation, mark the end of the
-		// cluster list and quit early.
-		if len(*pq) == 0 {
+		// If no clusters have any color variation, or a single cluster
+		// was requested, mark the end of the cluster list and quit early.
+		if len(*pq) == 0 || i == len(qz.cs) {
 			qz.cs = qz.cs[:i]
 			break
 		}
+		// Switch to the population x volume rule halfway through.
+		if qz.Priority == ByPopulationVolume && qz.phase == 0 && i >= len(qz.cs)/2 {
+			qz.phase = 1
+			for _, c := range *pq {
+				c.priority = qz.priority(c)
+			}
+			heap.Init(pq)
+		}
 		s := heap.Pop(pq).(*cluster) // get cluster to split
 		c = &qz.cs[i]                // set c to new cluster
+		c.index = i
+		qz.pt[i] = s.index
 		i++
-		m := qz.Median(s)
+		m := qz.cutPoint(s)
 		qz.Split(s, c, m) // split s into c and s
 		// If that was the last cluster, we're done.
 		if i == len(qz.cs) {
@@ -115,7 +250,9 @@ func (q *Quant) setColorRange(c *cluster) {
 	minR := uint32(math.MaxUint32)
 	minG := uint32(math.MaxUint32)
 	minB := uint32(math.MaxUint32)
+	c.weight = 0
 	for _, p := range c.px {
+		c.weight += q.weight(p)
 		r, g, b, _ := q.img.At(p.x, p.y).RGBA()
 		if r < minR {
 			minR = r
@@ -151,33 +288,35 @@ func (q *Quant) setColorRange(c *cluster) {
 		max = maxB
 	}
 	c.widestCh = s
+	c.chMin = min
 	c.chRange = max - min // also store the range of that channel
+	c.volume = float64(maxR-minR+0x101) * float64(maxG-minG+0x101) * float64(maxB-minB+0x101) / (0x101 * 0x101 * 0x101)
+	c.axis = [3]float64{}
+	if q.PrincipalAxis && c.chRange > 0 {
+		q.setAxis(c)
+	}
+	c.priority = q.priority(c)
 }
 
 func (q *Quant) Median(c *cluster) uint32 {
 	px := c.px
 	ch := q.ch[:len(px)]
 	// Copy values from appropriate channel to buffer for computing median.
-	switch c.widestCh {
-	case rx:
-		for i, p := range c.px {
-			ch[i], _, _, _ = q.img.At(p.x, p.y).RGBA()
-		}
-	case gx:
-		for i, p := range c.px {
-			_, ch[i], _, _ = q.img.At(p.x, p.y).RGBA()
-		}
-	case bx:
-		for i, p := range c.px {
-			_, _, ch[i], _ = q.img.At(p.x, p.y).RGBA()
-		}
+	for i, p := range px {
+		_, _, _, ch[i] = q.channel(c, p)
 	}
-	// Median algorithm.
-	sort.Sort(ch)
+	// Median algorithm. Select the middle value in linear time instead of sorting,
+	// for an even number of values average it with the largest value below it.
 	half := len(ch) / 2
-	m := ch[half]
+	m := ch.nth(half)
 	if len(ch)%2 == 0 {
-		m = (m + ch[half-1]) / 2
+		lo := ch[0]
+		for _, v := range ch[1:half] {
+			if v > lo {
+				lo = v
+			}
+		}
+		m = (m + lo) / 2
 	}
 	return m
 }
@@ -191,15 +330,7 @@ func (q *Quant) Split(s, c *cluster, m uint32) {
 	eq := q.eq[:0] // reuse any existing buffer
 	for i <= gt {
 		// Get pixel value of appropriate channel.
-		r, g, b, _ := q.img.At(px[i].x, px[i].y).RGBA()
-		switch s.widestCh {
-		case rx:
-			v = r
-		case gx:
-			v = g
-		case bx:
-			v = b
-		}
+		_, _, _, v = q.channel(s, px[i])
 		// Categorize each pixel as either <, >, or == median.
 		switch {
 		case v < m:
@@ -230,45 +361,161 @@ func (q *Quant) Split(s, c *cluster, m uint32) {
 	c.px = px[i:]
 }
 
+// Paletted generates an image.Paletted from the clusters.
+// It panics if the palette doesn't fit in 8 bit indices, use Paletted16 for larger palettes.
 func (qz *Quant) Paletted() image.PalettedImage {
-	cp := make(color.Palette, len(qz.cs))
+	es := qz.entries()
+	if len(es) > 256 {
+		panic(ErrTooManyColors)
+	}
+	cp := make(color.Palette, len(es))
 	pi := image.NewPaletted(qz.img.Bounds(), cp)
+	for i, e := range es {
+		cp[i] = e.c
+		// set image pixels
+		for _, p := range e.px {
+			pi.SetColorIndex(p.x, p.y, uint8(i))
+		}
+	}
+	return pi
+}
+
+// entry is a palette color along with the points mapped to it.
+type entry struct {
+	c  color.Color
+	px []point
+}
+
+// entries returns the palette entries: the fixed colors followed by the cluster colors in the palette order.
+func (qz *Quant) entries() []entry {
+	es := make([]entry, 0, len(qz.Fixed)+len(qz.cs))
+	for i, c := range qz.Fixed {
+		es = append(es, entry{c, qz.fx[i]})
+	}
 	for i := range qz.cs {
 		px := qz.cs[i].px
 		// Average values in cluster to get palette color.
-		var rsum, gsum, bsum int64
+		es = append(es, entry{qz.average(px), px})
+	}
+	qz.order(es)
+	return es
+}
+
+// weighted reports whether the points have individual weights.
+func (qz *Quant) weighted() bool {
+	return qz.wt != nil || qz.Weights != nil
+}
+
+// weight returns the weight of a point, used for prioritizing the clusters and averaging the colors.
+func (qz *Quant) weight(p point) float64 {
+	if !qz.weighted() {
+		return 1
+	}
+	w := 1.0
+	// Coordinates relative to the origin of the image holding the point.
+	b := qz.img.Bounds()
+	x, y := p.x-b.Min.X, p.y-b.Min.Y
+	if qz.at != nil {
+		i := qz.at.index(p.y)
+		if qz.wt != nil {
+			w = qz.wt[i]
+		}
+		y -= qz.at.offsets[i]
+	}
+	if qz.Weights != nil {
+		wb := qz.Weights.Bounds()
+		w *= float64(qz.Weights.GrayAt(wb.Min.X+x, wb.Min.Y+y).Y) / 0xff
+	}
+	return w
+}
+
+// average returns the average color of the points.
+func (qz *Quant) average(px []point) color.NRGBA64 {
+	if qz.weighted() {
+		var rsum, gsum, bsum, wsum float64
 		for _, p := range px {
+			w := qz.weight(p)
 			r, g, b, _ := qz.img.At(p.x, p.y).RGBA()
-			rsum += int64(r)
-			gsum += int64(g)
-			bsum += int64(b)
+			rsum += w * float64(r)
+			gsum += w * float64(g)
+			bsum += w * float64(b)
+			wsum += w
 		}
-		n64 := int64(len(px))
-		cp[i] = color.NRGBA64{
-			uint16(rsum / n64),
-			uint16(gsum / n64),
-			uint16(bsum / n64),
-			0xffff,
-		}
-		// set image pixels
-		for _, p := range px {
-			pi.SetColorIndex(p.x, p.y, uint8(i))
+		// Fall back to the plain average if all the points have zero weight.
+		if wsum > 0 {
+			return color.NRGBA64{
+				uint16(rsum/wsum + 0.5),
+				uint16(gsum/wsum + 0.5),
+				uint16(bsum/wsum + 0.5),
+				0xffff,
+			}
 		}
 	}
-	return pi
+	var rsum, gsum, bsum int64
+	for _, p := range px {
+		r, g, b, _ := qz.img.At(p.x, p.y).RGBA()
+		rsum += int64(r)
+		gsum += int64(g)
+		bsum += int64(b)
+	}
+	n64 := int64(len(px))
+	return color.NRGBA64{
+		uint16(rsum / n64),
+		uint16(gsum / n64),
+		uint16(bsum / n64),
+		0xffff,
+	}
 }
 
-// Implement sort.Interface for sort in median algorithm.
-func (c chValues) Len() int           { return len(c) }
-func (c chValues) Less(i, j int) bool { return c[i] < c[j] }
-func (c chValues) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+// nth returns the k-th smallest value using quickselect. The values are reordered
+// so that the ones before index k are not greater than the returned value.
+func (c chValues) nth(k int) uint32 {
+	lo, hi := 0, len(c)-1
+	for lo < hi {
+		// Use the median of three as pivot to avoid the worst case on sorted input.
+		mid := lo + (hi-lo)/2
+		if c[mid] < c[lo] {
+			c[mid], c[lo] = c[lo], c[mid]
+		}
+		if c[hi] < c[lo] {
+			c[hi], c[lo] = c[lo], c[hi]
+		}
+		if c[hi] < c[mid] {
+			c[hi], c[mid] = c[mid], c[hi]
+		}
+		pivot := c[mid]
+		i, j := lo, hi
+		for i <= j {
+			for c[i] < pivot {
+				i++
+			}
+			for c[j] > pivot {
+				j--
+			}
+			if i <= j {
+				c[i], c[j] = c[j], c[i]
+				i++
+				j--
+			}
+		}
+		switch {
+		case k <= j:
+			hi = j
+		case k >= i:
+			lo = i
+		default:
+			return c[k] // the values between j and i are equal to the pivot
+		}
+	}
+	return c[k]
+}
 
 // Implement heap.Interface for priority queue of clusters.
 func (q queue) Len() int { return len(q) }
 
-// Less implements rule to select cluster with greatest number of pixels.
+// Less implements rule to select cluster with the highest split priority.
 func (q queue) Less(i, j int) bool {
-	return len(q[j].px) < len(q[i].px)
+	return q[j].priority < q[i].priority
 }
 
 func (q queue) Swap(i, j int) {
@@ -284,4 +531,4 @@ func (pq *queue) Pop() interface{} {
 	c := q[n]
 	*pq = q[:n]
 	return c
-}
\ No newline at end of file
+}
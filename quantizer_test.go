@@ -39,12 +39,14 @@ func TestQuant_Median(t *testing.T) {
 	qz.cluster()
 
 	cls := &cluster{
-		[]point{
+		px: []point{
 			{0, 0},
 			{1, 0},
 			{0, 1},
 			{1, 1},
-		}, 1, 1,
+		},
+		widestCh: 1,
+		chRange:  1,
 	}
 	res := qz.Median(cls)
 	if res != 0 {
@@ -76,4 +78,24 @@ func TestQuant_Level (t *testing.T) {
 			t.Errorf("The quantization level should be %d, got %d", quantLevel, len(reds))
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestQuant_Quality(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), 0x80, 0xff})
+		}
+	}
+	res := Quant{}.Quantize(img, 64)
+	m, err := Compare(img, res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.PSNR < 30 {
+		t.Errorf("Quantizing a gradient to 64 colors should give a PSNR above 30 dB, got %.2f", m.PSNR)
+	}
+	if m.MeanDeltaE > 4 {
+		t.Errorf("The average ΔE should be below 4, got %.2f", m.MeanDeltaE)
+	}
+}
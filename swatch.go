@@ -0,0 +1,63 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// Swatch is a representative color of an image, returned by the palette extraction.
+type Swatch struct {
+	Color    color.NRGBA64
+	Count    int     // number of pixels represented by the color
+	Coverage float64 // fraction of the image pixels represented by the color
+	Variance float64 // mean squared distance of the represented pixels from the color, in 8 bit R,G,B units
+}
+
+// Extract returns the dominant colors of the image. It runs the same median cut clustering
+// as Quantize, but instead of generating a paletted image it returns the palette entries
+// with their pixel count, coverage and variance, sorted by decreasing pixel count.
+func (q Quant) Extract(img image.Image, nq int) []Swatch {
+	qz := q.workspace(img, nq)
+	qz.cluster()
+
+	es := qz.entries()
+	total := 0
+	for _, e := range es {
+		total += len(e.px)
+	}
+	swatches := make([]Swatch, 0, len(es))
+	for _, e := range es {
+		sw := Swatch{
+			Color:    color.NRGBA64Model.Convert(e.c).(color.NRGBA64),
+			Count:    len(e.px),
+			Coverage: float64(len(e.px)) / float64(total),
+		}
+		if len(e.px) > 0 {
+			cr, cg, cb, _ := e.c.RGBA()
+			mr, mg, mb := float64(cr)/257, float64(cg)/257, float64(cb)/257
+
+			var sum float64
+			for _, p := range e.px {
+				r, g, b, _ := img.At(p.x, p.y).RGBA()
+				dr, dg, db := float64(r)/257-mr, float64(g)/257-mg, float64(b)/257-mb
+				sum += dr*dr + dg*dg + db*db
+			}
+			sw.Variance = sum / float64(len(e.px))
+		}
+		swatches = append(swatches, sw)
+	}
+	sort.SliceStable(swatches, func(i, j int) bool {
+		return swatches[i].Count > swatches[j].Count
+	})
+	return swatches
+}
+
+// Palette returns the colors of the swatches.
+func Palette(swatches []Swatch) color.Palette {
+	p := make(color.Palette, len(swatches))
+	for i, s := range swatches {
+		p[i] = s.Color
+	}
+	return p
+}
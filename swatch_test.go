@@ -0,0 +1,37 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQuant_Extract(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			// 70% red, 30% blue.
+			if x < 7 {
+				img.Set(x, y, color.RGBA{0xff, 0, 0, 0xff})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 0xff, 0xff})
+			}
+		}
+	}
+	swatches := Quant{}.Extract(img, 4)
+	if len(swatches) != 2 {
+		t.Fatalf("Expected 2 swatches, got %d", len(swatches))
+	}
+	if c := swatches[0].Color; c.R != 0xffff || c.B != 0 {
+		t.Errorf("The most dominant color should be red, got %v", c)
+	}
+	if swatches[0].Count != 70 || swatches[0].Coverage != 0.7 {
+		t.Errorf("Expected the red swatch to cover 70 pixels, got %d (%.2f)", swatches[0].Count, swatches[0].Coverage)
+	}
+	if swatches[0].Variance != 0 || swatches[1].Variance != 0 {
+		t.Errorf("Solid colors should have zero variance")
+	}
+	if p := Palette(swatches); len(p) != 2 {
+		t.Errorf("Expected a palette of 2 colors, got %d", len(p))
+	}
+}
@@ -0,0 +1,335 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+)
+
+// TileQuant is a quantizer for the color constraints of the old consoles and computers, which limit
+// the colors of each tile to one of a few sub-palettes. The sub-palettes are built by the median cut
+// from the tiles using them, each tile is assigned the sub-palette reproducing it best, and the two
+// steps are repeated until the assignment settles. Finally the image is dithered, every pixel within
+// the sub-palette of its tile.
+type TileQuant struct {
+	// TileWidth and TileHeight are the size of the area sharing a sub-palette. Default to 8.
+	TileWidth, TileHeight int
+	// SubPalettes is the number of sub-palettes. Defaults to 4.
+	SubPalettes int
+	// Colors is the number of colors of each sub-palette, including the shared color. Defaults to 4.
+	Colors int
+	// Shared makes the first color of all the sub-palettes the same, like the background color of the NES.
+	Shared bool
+	// Background is the shared color. If nil, the most common color of the image is used.
+	Background color.Color
+	// Palette optionally restricts the sub-palette colors to the colors of a hardware palette.
+	Palette color.Palette
+	// Dither is the optional error diffusion applied when mapping the pixels to their sub-palette.
+	Dither Dither
+	// Candidates optionally fixes the sub-palettes, for hardware with a fixed set of color combinations.
+	// Each tile is assigned the candidate reproducing it best, SubPalettes and Colors follow the candidates.
+	Candidates []color.Palette
+}
+
+// TiledImage is a paletted image whose tiles use a single sub-palette each.
+// The palette is the concatenation of the sub-palettes.
+type TiledImage struct {
+	*image.Paletted
+	TileWidth, TileHeight int
+	// Colors is the number of colors of each sub-palette: the i-th sub-palette
+	// occupies the palette slots from i*Colors to (i+1)*Colors.
+	Colors int
+	// Attributes holds the index of the sub-palette of each tile, row by row.
+	Attributes []int
+	// Columns is the number of tiles in a row.
+	Columns int
+}
+
+// SubPalette returns the i-th sub-palette.
+func (t *TiledImage) SubPalette(i int) color.Palette {
+	return t.Palette[i*t.Colors : (i+1)*t.Colors]
+}
+
+// Attribute returns the index of the sub-palette of the tile containing the pixel at (x, y).
+func (t *TiledImage) Attribute(x, y int) int {
+	tx, ty := (x-t.Rect.Min.X)/t.TileWidth, (y-t.Rect.Min.Y)/t.TileHeight
+	return t.Attributes[ty*t.Columns+tx]
+}
+
+// NESTiles returns the tile constraints of the NES background: 4 sub-palettes of 3 colors plus the
+// shared background color, from the 2C02 palette. The attribute table assigns the sub-palettes to 16×16 areas.
+func NESTiles() TileQuant {
+	p, _ := HardwarePalette("nes")
+	return TileQuant{TileWidth: 16, TileHeight: 16, SubPalettes: 4, Colors: 4, Shared: true, Palette: p}
+}
+
+// ZXSpectrumTiles returns the attribute constraints of the ZX Spectrum: each 8×8 cell shows an ink and
+// a paper color of the 15 color palette, both normal or both bright. The candidates are all the 71 pairs.
+func ZXSpectrumTiles() TileQuant {
+	return TileQuant{TileWidth: 8, TileHeight: 8, Candidates: zxAttributes()}
+}
+
+// zxAttributes returns the color pairs a ZX Spectrum cell can display, sharing the BRIGHT bit.
+// The pairs differing only in the order of the colors are listed once.
+func zxAttributes() []color.Palette {
+	p, _ := HardwarePalette("zxspectrum")
+	var pairs []color.Palette
+	for bright := 0; bright < 16; bright += 8 {
+		for ink := 0; ink < 8; ink++ {
+			for paper := ink; paper < 8; paper++ {
+				if bright > 0 && paper == 0 {
+					continue // bright black is black
+				}
+				pairs = append(pairs, color.Palette{p[bright+ink], p[bright+paper]})
+			}
+		}
+	}
+	return pairs
+}
+
+// GameBoyColorTiles returns the tile constraints of the Game Boy Color background:
+// 8 sub-palettes of 4 colors, from the 15 bit RGB colors.
+func GameBoyColorTiles() TileQuant {
+	return TileQuant{TileWidth: 8, TileHeight: 8, SubPalettes: 8, Colors: 4, Palette: PosterizeBits(5, 5, 5).Palette()}
+}
+
+// tileIterations is the maximum number of the sub-palette building and tile assignment rounds.
+const tileIterations = 8
+
+// Quantize maps the image onto the sub-palettes. It returns ErrTooManyColors
+// if the sub-palettes don't fit in the 256 colors of a paletted image.
+func (tq TileQuant) Quantize(img image.Image) (*TiledImage, error) {
+	tq.defaults()
+	if tq.SubPalettes*tq.Colors > 256 {
+		return nil, ErrTooManyColors
+	}
+	b := img.Bounds()
+	cols := (b.Dx() + tq.TileWidth - 1) / tq.TileWidth
+	rows := (b.Dy() + tq.TileHeight - 1) / tq.TileHeight
+	if cols*rows == 0 {
+		return &TiledImage{Paletted: image.NewPaletted(b, nil), TileWidth: tq.TileWidth, TileHeight: tq.TileHeight, Colors: tq.Colors}, nil
+	}
+	tiles := make([]image.Image, 0, cols*rows)
+	for ty := 0; ty < rows; ty++ {
+		for tx := 0; tx < cols; tx++ {
+			r := image.Rect(tx*tq.TileWidth, ty*tq.TileHeight, (tx+1)*tq.TileWidth, (ty+1)*tq.TileHeight)
+			tiles = append(tiles, tileView{img, r.Add(b.Min).Intersect(b)})
+		}
+	}
+	var fixed color.Palette
+	if tq.Shared {
+		bg := tq.Background
+		if bg == nil {
+			bg = mostCommon(img)
+		}
+		fixed = color.Palette{tq.snap(bg)}
+	}
+
+	var subs []color.Palette
+	var attrs []int
+	if len(tq.Candidates) > 0 {
+		subs = make([]color.Palette, len(tq.Candidates))
+		for i, c := range tq.Candidates {
+			subs[i] = tq.pad(c)
+		}
+		attrs = make([]int, len(tiles))
+		assign(tiles, subs, attrs)
+	} else {
+		subs, attrs = tq.build(tiles, fixed)
+	}
+
+	pal := make(color.Palette, 0, tq.SubPalettes*tq.Colors)
+	values := make([][][4]int32, len(subs))
+	trees := make([]*kdTree, len(subs))
+	for i, p := range subs {
+		pal = append(pal, p...)
+		values[i] = paletteValues(p)
+		trees[i] = newKDTree(values[i], rgbaWeights)
+	}
+	dst := &TiledImage{
+		Paletted:   image.NewPaletted(b, pal),
+		TileWidth:  tq.TileWidth,
+		TileHeight: tq.TileHeight,
+		Colors:     tq.Colors,
+		Attributes: attrs,
+		Columns:    cols,
+	}
+	pix, stride := dst.Pix, dst.Stride
+	tq.Dither.diffuse(img, true, func(x, y int, r, g, b, a int32) (int32, int32, int32) {
+		s := attrs[(y/tq.TileHeight)*cols+x/tq.TileWidth]
+		i := trees[s].nearest(r, g, b, a)
+		pix[y*stride+x] = uint8(s*tq.Colors + i)
+		return values[s][i][0], values[s][i][1], values[s][i][2]
+	})
+	return dst, nil
+}
+
+func (tq *TileQuant) defaults() {
+	if len(tq.Candidates) > 0 {
+		tq.SubPalettes, tq.Colors = len(tq.Candidates), 0
+		for _, c := range tq.Candidates {
+			if len(c) > tq.Colors {
+				tq.Colors = len(c)
+			}
+		}
+	}
+	if tq.TileWidth < 1 {
+		tq.TileWidth = 8
+	}
+	if tq.TileHeight < 1 {
+		tq.TileHeight = 8
+	}
+	if tq.SubPalettes < 1 {
+		tq.SubPalettes = 4
+	}
+	if tq.Colors < 1 {
+		tq.Colors = 4
+	}
+}
+
+// build returns the sub-palettes built from the tiles, and the sub-palette assigned to each tile.
+func (tq TileQuant) build(tiles []image.Image, fixed color.Palette) ([]color.Palette, []int) {
+	attrs := tq.seed(tiles)
+	subs := make([]color.Palette, tq.SubPalettes)
+	for iter := 0; iter < tileIterations; iter++ {
+		// Build the sub-palettes from the tiles assigned to them.
+		groups := make([][]image.Image, tq.SubPalettes)
+		for i, a := range attrs {
+			groups[a] = append(groups[a], tiles[i])
+		}
+		for i, g := range groups {
+			if len(g) == 0 {
+				if subs[i] == nil {
+					subs[i] = tq.pad(fixed)
+				}
+				continue // keep the previous sub-palette
+			}
+			subs[i] = tq.pad(Quant{Fixed: fixed}.SharedPalette(g, nil, tq.Colors))
+		}
+		// Assign every tile the sub-palette with the smallest error.
+		if !assign(tiles, subs, attrs) && iter > 0 {
+			break
+		}
+	}
+	return subs, attrs
+}
+
+// assign gives every tile the sub-palette with the smallest error, and reports whether any assignment changed.
+func assign(tiles []image.Image, subs []color.Palette, attrs []int) bool {
+	values := make([][][4]int32, len(subs))
+	trees := make([]*kdTree, len(subs))
+	for i, p := range subs {
+		values[i] = paletteValues(p)
+		trees[i] = newKDTree(values[i], rgbaWeights)
+	}
+	changed := false
+	for i, t := range tiles {
+		best, bestErr := attrs[i], tileError(t, values[attrs[i]], trees[attrs[i]])
+		for j := range subs {
+			if e := tileError(t, values[j], trees[j]); e < bestErr {
+				best, bestErr = j, e
+			}
+		}
+		if best != attrs[i] {
+			attrs[i], changed = best, true
+		}
+	}
+	return changed
+}
+
+// mostCommon returns the color of the most pixels of the image. The ties go to the color reaching
+// the count first, in row order. It returns black for an empty image.
+func mostCommon(img image.Image) color.Color {
+	var best color.Color = color.Black
+	most := 0
+	counts := make(map[color.RGBA64]int)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			c := color.RGBA64{uint16(r), uint16(g), uint16(bl), uint16(a)}
+			counts[c]++
+			if counts[c] > most {
+				best, most = c, counts[c]
+			}
+		}
+	}
+	return best
+}
+
+// seed returns the initial sub-palette of each tile, by clustering the average colors of the tiles.
+func (tq TileQuant) seed(tiles []image.Image) []int {
+	means := image.NewRGBA64(image.Rect(0, 0, len(tiles), 1))
+	for i, t := range tiles {
+		var sum [3]uint64
+		b := t.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, _ := t.At(x, y).RGBA()
+				sum[0] += uint64(r)
+				sum[1] += uint64(g)
+				sum[2] += uint64(bl)
+			}
+		}
+		n := uint64(b.Dx() * b.Dy())
+		means.SetRGBA64(i, 0, color.RGBA64{uint16(sum[0] / n), uint16(sum[1] / n), uint16(sum[2] / n), 0xffff})
+	}
+	attrs := make([]int, len(tiles))
+	if tq.SubPalettes == 1 {
+		return attrs
+	}
+	p := Quant{}.Quantize(means, tq.SubPalettes).(*image.Paletted)
+	for i := range attrs {
+		attrs[i] = int(p.Pix[i])
+	}
+	return attrs
+}
+
+// pad snaps the colors to the hardware palette, and repeats the last color
+// to fill the sub-palette if the tiles have fewer colors.
+func (tq TileQuant) pad(p color.Palette) color.Palette {
+	sub := make(color.Palette, tq.Colors)
+	for i := range sub {
+		switch {
+		case i < len(p):
+			sub[i] = tq.snap(p[i])
+		case i > 0:
+			sub[i] = sub[i-1]
+		default:
+			sub[i] = tq.snap(color.Black)
+		}
+	}
+	return sub
+}
+
+// snap returns the closest color of the hardware palette, or the color itself if there is no hardware palette.
+func (tq TileQuant) snap(c color.Color) color.Color {
+	if len(tq.Palette) == 0 {
+		return c
+	}
+	return tq.Palette.Convert(c)
+}
+
+// tileError returns the sum of the squared distances of the tile pixels to their closest sub-palette color.
+func tileError(t image.Image, values [][4]int32, tree *kdTree) float64 {
+	var sum float64
+	b := t.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := t.At(x, y).RGBA()
+			c := values[tree.nearest(int32(r), int32(g), int32(bl), int32(a))]
+			for ch, v := range [4]uint32{r, g, bl, a} {
+				d := float64(int32(v) - c[ch])
+				sum += d * d
+			}
+		}
+	}
+	return sum
+}
+
+// tileView is a rectangular part of an image.
+type tileView struct {
+	image.Image
+	rect image.Rectangle
+}
+
+func (t tileView) Bounds() image.Rectangle { return t.rect }
@@ -0,0 +1,142 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// checker returns an image of 8x8 tiles, each striped with two colors picked from the pairs
+// according to the quadrant of the image.
+func checker(pairs [4][2]color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			q := (y/16)*2 + x/16
+			img.SetRGBA(x, y, pairs[q][(x+y)%2])
+		}
+	}
+	return img
+}
+
+func TestTileQuant(t *testing.T) {
+	pairs := [4][2]color.RGBA{
+		{{0xff, 0, 0, 0xff}, {0, 0, 0xff, 0xff}},
+		{{0, 0xff, 0, 0xff}, {0xff, 0xff, 0, 0xff}},
+		{{0, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0xff}},
+		{{0xff, 0, 0xff, 0xff}, {0, 0xff, 0xff, 0xff}},
+	}
+	img := checker(pairs)
+	res, err := TileQuant{SubPalettes: 4, Colors: 2}.Quantize(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Palette) != 8 || len(res.Attributes) != 16 || res.Columns != 4 {
+		t.Fatalf("Unexpected layout: %d colors, %d attributes, %d columns", len(res.Palette), len(res.Attributes), res.Columns)
+	}
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if i := int(res.ColorIndexAt(x, y)); i/res.Colors != res.Attribute(x, y) {
+				t.Fatalf("The pixel (%d, %d) uses a color outside the sub-palette of its tile", x, y)
+			}
+		}
+	}
+	if !samePixels(img, res) {
+		t.Error("Four sub-palettes of two colors should reproduce the image exactly")
+	}
+}
+
+func TestTileQuant_Shared(t *testing.T) {
+	img := gradient(64, 64)
+	tq := NESTiles()
+	tq.Dither = Dither{Filter: [][]float32{
+		{0, 0, 7.0 / 16},
+		{3.0 / 16, 5.0 / 16, 1.0 / 16},
+	}}
+	res, err := tq.Quantize(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nes, _ := HardwarePalette("nes")
+	for i := 0; i < tq.SubPalettes; i++ {
+		sub := res.SubPalette(i)
+		if !sameColor(sub[0], res.SubPalette(0)[0]) {
+			t.Errorf("The sub-palette %d should start with the shared color", i)
+		}
+		for _, c := range sub {
+			if !sameColor(nes.Convert(c), c) {
+				t.Errorf("The color %v is not in the NES palette", c)
+			}
+		}
+	}
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			if i := int(res.ColorIndexAt(x, y)); i/res.Colors != res.Attribute(x, y) {
+				t.Fatalf("The pixel (%d, %d) uses a color outside the sub-palette of its tile", x, y)
+			}
+		}
+	}
+}
+
+func TestTileQuant_TooManyColors(t *testing.T) {
+	if _, err := (TileQuant{SubPalettes: 65, Colors: 4}).Quantize(gradient(8, 8)); err != ErrTooManyColors {
+		t.Errorf("Expected ErrTooManyColors, got %v", err)
+	}
+}
+
+func TestZXSpectrumTiles(t *testing.T) {
+	if n := len(zxAttributes()); n != 71 {
+		t.Errorf("Expected 71 ink and paper pairs, got %d", n)
+	}
+	hw, _ := HardwarePalette("zxspectrum")
+	bright := func(c color.Color) bool {
+		for i, h := range hw {
+			if sameColor(c, h) {
+				return i >= 8 && !sameColor(c, color.Black)
+			}
+		}
+		t.Fatalf("The color %v is not a ZX Spectrum color", c)
+		return false
+	}
+	tq := ZXSpectrumTiles()
+	tq.Dither = FloydSteinberg
+	res, err := tq.Quantize(noisy(9, 32, 24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range res.Attributes {
+		sub := res.SubPalette(res.Attributes[i])
+		// Black goes with both the normal and the bright colors.
+		if bright(sub[0]) != bright(sub[1]) && !sameColor(sub[0], color.Black) && !sameColor(sub[1], color.Black) {
+			t.Errorf("The cell %d mixes normal and bright colors: %v", i, sub)
+		}
+	}
+	// Every pixel uses a color of its cell.
+	b := res.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if i := int(res.ColorIndexAt(x, y)) / res.Colors; i != res.Attribute(x, y) {
+				t.Fatalf("The pixel (%d, %d) uses the sub-palette %d instead of %d", x, y, i, res.Attribute(x, y))
+			}
+		}
+	}
+}
+
+func TestMostCommon(t *testing.T) {
+	// The average of the larger group of similar colors doesn't appear in the image,
+	// the most common color is the exact color of the most pixels.
+	img := image.NewRGBA(image.Rect(0, 0, 10, 1))
+	colors := []color.RGBA{
+		{0x10, 0, 0, 0xff}, {0x20, 0, 0, 0xff}, {0x30, 0, 0, 0xff}, {0x40, 0, 0, 0xff}, {0x50, 0, 0, 0xff}, {0x60, 0, 0, 0xff},
+		{0, 0, 0xff, 0xff}, {0, 0, 0xff, 0xff}, {0, 0, 0xff, 0xff}, {0, 0xff, 0, 0xff},
+	}
+	for x, c := range colors {
+		img.SetRGBA(x, 0, c)
+	}
+	if c := mostCommon(img); !sameColor(c, color.RGBA{0, 0, 0xff, 0xff}) {
+		t.Errorf("Expected blue as the most common color, got %v", c)
+	}
+	if c := mostCommon(image.NewRGBA(image.Rectangle{})); !sameColor(c, color.Black) {
+		t.Errorf("Expected black for an empty image, got %v", c)
+	}
+}
@@ -0,0 +1,205 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+)
+
+// VariableDither implements Ostromoukhov's variable-coefficient error diffusion.
+// Unlike the fixed kernels of Dither, the three diffusion coefficients (right, down-left, down)
+// depend on the intensity of the processed pixel, which removes most of the worm like artifacts
+// of the classic kernels in the mid-tones. The image is traversed in serpentine order.
+//
+// Each channel is processed independently. Optionally the Zhou-Fang threshold modulation
+// can be enabled, which further breaks up the regular patterns around the critical intensity levels.
+type VariableDither struct {
+	// Gray dithers the luminance of the image only and produces gray output.
+	Gray bool
+	// Levels is the number of output levels per channel. Defaults to 2 (black and white).
+	Levels int
+	// Modulation enables the Zhou-Fang intensity dependent threshold modulation.
+	Modulation bool
+	// Seed is used to initialize the random source of the threshold modulation.
+	// The output is reproducible for a given seed.
+	Seed int64
+}
+
+// varCoef holds the diffusion coefficients at the key intensity levels between 0 and 127.
+// The values in between are linearly interpolated, the upper half is symmetric to the lower half.
+var varCoef = []struct {
+	level              int
+	right, dleft, down float64
+}{
+	{0, 13, 0, 5},
+	{1, 1300249, 0, 499250},
+	{2, 213113, 287, 99357},
+	{3, 351854, 0, 199965},
+	{4, 801100, 0, 490999},
+	{10, 704075, 297466, 303694},
+	{22, 46613, 31917, 21469},
+	{32, 47482, 30617, 21900},
+	{44, 43024, 42131, 14826},
+	{64, 36411, 43219, 20369},
+	{72, 38477, 53843, 7678},
+	{77, 40503, 51547, 7948},
+	{85, 35865, 34108, 30026},
+	{95, 34117, 36899, 28983},
+	{102, 35464, 35049, 29486},
+	{107, 16477, 18810, 14712},
+	{112, 33360, 37954, 28685},
+	{127, 35269, 36066, 28664},
+}
+
+// varStrength holds the threshold modulation strength at the key intensity levels.
+var varStrength = []struct {
+	level    int
+	strength float64
+}{
+	{0, 0}, {44, 0.34}, {64, 0.50}, {85, 1.00}, {95, 0.17},
+	{102, 0.50}, {107, 0.70}, {112, 0.79}, {127, 1.00},
+}
+
+// coefficients returns the normalized right, down-left and down diffusion coefficients
+// for an intensity level between 0 and 255.
+func coefficients(level int) (float32, float32, float32) {
+	if level > 127 {
+		level = 255 - level
+	}
+	for i := 1; i < len(varCoef); i++ {
+		lo, hi := varCoef[i-1], varCoef[i]
+		if level > hi.level {
+			continue
+		}
+		// Interpolate the normalized coefficients of the surrounding key levels.
+		t := float64(level-lo.level) / float64(hi.level-lo.level)
+		los := lo.right + lo.dleft + lo.down
+		his := hi.right + hi.dleft + hi.down
+		r := lo.right/los + t*(hi.right/his-lo.right/los)
+		dl := lo.dleft/los + t*(hi.dleft/his-lo.dleft/los)
+		d := lo.down/los + t*(hi.down/his-lo.down/los)
+		return float32(r), float32(dl), float32(d)
+	}
+	return 0, 0, 0
+}
+
+// modulation returns the threshold modulation strength for an intensity level between 0 and 255.
+func modulation(level int) float32 {
+	if level > 127 {
+		level = 255 - level
+	}
+	for i := 1; i < len(varStrength); i++ {
+		lo, hi := varStrength[i-1], varStrength[i]
+		if level > hi.level {
+			continue
+		}
+		t := float64(level-lo.level) / float64(hi.level-lo.level)
+		return float32(lo.strength + t*(hi.strength-lo.strength))
+	}
+	return 0
+}
+
+// Quantize dithers the source image into the destination image. The nq and useQuantizer
+// parameters are ignored, the output colors are defined by the number of levels per channel.
+// If dst is an *image.Paletted the dithered colors are mapped onto its palette.
+func (vd VariableDither) Quantize(src image.Image, dst draw.Image, nq int, useDither bool, useQuantizer bool) image.Image {
+	levels := vd.Levels
+	if levels < 2 {
+		levels = 2
+	}
+	step := float32(255) / float32(levels-1)
+	rnd := rand.New(rand.NewSource(vd.Seed))
+
+	nch := 3
+	if vd.Gray {
+		nch = 1
+	}
+	b, db := src.Bounds(), dst.Bounds()
+	dx, dy := b.Dx(), b.Dy()
+
+	// Error buffers for the current and the next row of each channel,
+	// with a one pixel margin on both sides.
+	cur := make([][]float32, nch)
+	next := make([][]float32, nch)
+	for c := 0; c < nch; c++ {
+		cur[c] = make([]float32, dx+2)
+		next[c] = make([]float32, dx+2)
+	}
+
+	var in, out [3]float32
+	for y := 0; y < dy; y++ {
+		// Serpentine scanning: even rows go from left to right, odd rows from right to left.
+		x0, x1, dir := 0, dx, 1
+		if y%2 == 1 {
+			x0, x1, dir = dx-1, -1, -1
+		}
+		for x := x0; x != x1; x += dir {
+			r, g, bl, _ := src.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			if vd.Gray {
+				in[0] = float32(19595*r+38470*g+7471*bl+1<<15) / float32(1<<24)
+			} else {
+				in[0], in[1], in[2] = float32(r>>8), float32(g>>8), float32(bl>>8)
+			}
+			for c := 0; c < nch; c++ {
+				v := in[c]
+				if useDither {
+					v += cur[c][x+1]
+				}
+				// Locate the interval of output levels the value falls into.
+				lo := float32(int(clampFloat(v, 0, 255)/step)) * step
+				if lo > 255-step {
+					lo = 255 - step
+				}
+				frac := (v - lo) / step
+				threshold := float32(0.5)
+				if vd.Modulation && useDither {
+					level := int(clampFloat(frac, 0, 1)*255 + 0.5)
+					threshold += (rnd.Float32() - 0.5) * 0.5 * modulation(level)
+				}
+				o := lo
+				if frac >= threshold {
+					o = lo + step
+				}
+				out[c] = o
+				if !useDither {
+					continue
+				}
+				// Diffuse the error using the coefficients belonging to the input intensity
+				// relative to its interval of output levels.
+				e := v - o
+				pos := clampFloat(in[c], 0, 255)
+				pos -= float32(int(pos/step)) * step
+				cr, cdl, cd := coefficients(int(pos/step*255 + 0.5))
+				cur[c][x+1+dir] += e * cr
+				next[c][x+1-dir] += e * cdl
+				next[c][x+1] += e * cd
+			}
+			px, py := db.Min.X+x, db.Min.Y+y
+			if vd.Gray {
+				dst.Set(px, py, color.Gray{uint8(out[0] + 0.5)})
+			} else {
+				dst.Set(px, py, color.RGBA{uint8(out[0] + 0.5), uint8(out[1] + 0.5), uint8(out[2] + 0.5), 0xff})
+			}
+		}
+		// Move on to the next row and reset its error buffer.
+		cur, next = next, cur
+		for c := 0; c < nch; c++ {
+			for i := range next[c] {
+				next[c][i] = 0
+			}
+		}
+	}
+	return dst
+}
+
+// clampFloat clamps v to the interval [lo, hi].
+func clampFloat(v, lo, hi float32) float32 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,57 @@
+package colorquant
+
+import (
+	"image"
+	"testing"
+)
+
+func TestVariableDither_GrayLevel(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 32, 32))
+	for i := range src.Pix {
+		src.Pix[i] = 0x40
+	}
+	dst := image.NewGray(src.Bounds())
+	VariableDither{Gray: true}.Quantize(src, dst, 2, true, false)
+
+	var sum int
+	for _, v := range dst.Pix {
+		if v != 0 && v != 0xff {
+			t.Fatalf("The output should contain only black and white pixels, got %d", v)
+		}
+		sum += int(v)
+	}
+	// The average intensity should be preserved.
+	if avg := sum / len(dst.Pix); avg < 0x38 || avg > 0x48 {
+		t.Errorf("The average intensity should be close to %d, got %d", 0x40, avg)
+	}
+}
+
+func TestVariableDither_Levels(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < len(src.Pix); i += 4 {
+		src.Pix[i], src.Pix[i+1], src.Pix[i+2], src.Pix[i+3] = 0x10, 0x80, 0xf0, 0xff
+	}
+	dst := image.NewRGBA(src.Bounds())
+	VariableDither{Levels: 3, Modulation: true, Seed: 1}.Quantize(src, dst, 0, true, false)
+
+	valid := map[uint8]bool{0: true, 0x80: true, 0xff: true}
+	for i, v := range dst.Pix {
+		if i%4 != 3 && !valid[v] {
+			t.Fatalf("Unexpected channel level %d", v)
+		}
+	}
+}
+
+func TestVariableDither_Coefficients(t *testing.T) {
+	for level := 0; level < 256; level++ {
+		r, dl, d := coefficients(level)
+		if sum := r + dl + d; sum < 0.999 || sum > 1.001 {
+			t.Fatalf("The coefficients of level %d should sum to 1, got %f", level, sum)
+		}
+	}
+	r1, _, _ := coefficients(10)
+	r2, _, _ := coefficients(245)
+	if r1 != r2 {
+		t.Error("The coefficients should be symmetric around the middle intensity")
+	}
+}
@@ -0,0 +1,106 @@
+package colorquant
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQuant_Weights(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	weights := image.NewGray(img.Bounds())
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 8 && y < 8 {
+				// A small red subject on a large blue background.
+				img.Set(x, y, color.RGBA{uint8(0x80 + x*16), 0, 0, 0xff})
+				weights.SetGray(x, y, color.Gray{0xff})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, uint8(0x40 + x*4), 0xff})
+				weights.SetGray(x, y, color.Gray{0x04})
+			}
+		}
+	}
+	reds := func(p color.Palette) int {
+		n := 0
+		for _, c := range p {
+			if r, _, b, _ := c.RGBA(); r > b {
+				n++
+			}
+		}
+		return n
+	}
+	plain := Quant{}.Quantize(img, 6).(*image.Paletted)
+	weighted := Quant{Weights: weights}.Quantize(img, 6).(*image.Paletted)
+
+	if reds(weighted.Palette) <= reds(plain.Palette) {
+		t.Errorf("The weighted subject should get more palette entries: %d with weights, %d without",
+			reds(weighted.Palette), reds(plain.Palette))
+	}
+}
+
+func TestQuant_WeightsBounds(t *testing.T) {
+	img := gradient(16, 16)
+	weights := image.NewGray(image.Rect(0, 0, 8, 8))
+	if _, err := (Quant{Weights: weights}).QuantizePaletted(img, 8); err != ErrWeights {
+		t.Errorf("Expected %v, got %v", ErrWeights, err)
+	}
+	if _, err := (Quant{Weights: weights}).Quantize16(img, 8); err != ErrWeights {
+		t.Errorf("Expected %v, got %v", ErrWeights, err)
+	}
+	// The weight map can be offset, only its size has to match.
+	offset := image.NewGray(image.Rect(5, 5, 21, 21))
+	if _, err := (Quant{Weights: offset}).QuantizePaletted(img, 8); err != nil {
+		t.Errorf("Expected no error for an offset weight map, got %v", err)
+	}
+	defer func() {
+		if r := recover(); r != ErrWeights {
+			t.Errorf("Quantize should panic with %v, got %v", ErrWeights, r)
+		}
+	}()
+	Quant{Weights: weights}.Quantize(img, 8)
+}
+
+func TestQuant_SharedWeights(t *testing.T) {
+	// Two frames with a red subject in the top left corner on a blue background.
+	frames := make([]image.Image, 2)
+	weights := image.NewGray(image.Rect(0, 0, 40, 40))
+	for i := range frames {
+		img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+		for y := 0; y < 40; y++ {
+			for x := 0; x < 40; x++ {
+				if x < 8 && y < 8 {
+					img.Set(x, y, color.RGBA{uint8(0x80 + x*16), 0, uint8(i * 8), 0xff})
+					weights.SetGray(x, y, color.Gray{0xff})
+				} else {
+					img.Set(x, y, color.RGBA{0, 0, uint8(0x40 + x*4 + i), 0xff})
+					weights.SetGray(x, y, color.Gray{0x04})
+				}
+			}
+		}
+		frames[i] = img
+	}
+	reds := func(p color.Palette) int {
+		n := 0
+		for _, c := range p {
+			if r, _, b, _ := c.RGBA(); r > b {
+				n++
+			}
+		}
+		return n
+	}
+	plain := Quant{}.SharedPalette(frames, []float64{1, 1}, 6)
+	weighted := Quant{Weights: weights}.SharedPalette(frames, []float64{1, 1}, 6)
+	if reds(weighted) <= reds(plain) {
+		t.Errorf("The weight map should apply to every image: %d red entries with weights, %d without",
+			reds(weighted), reds(plain))
+	}
+
+	defer func() {
+		if r := recover(); r != ErrWeights {
+			t.Errorf("SharedPalette should panic with %v, got %v", ErrWeights, r)
+		}
+	}()
+	frames = append(frames, gradient(8, 8))
+	Quant{Weights: weights}.SharedPalette(frames, nil, 6)
+}